@@ -0,0 +1,164 @@
+package bench
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// ChangePoint is a level shift in a sequence of values.
+type ChangePoint struct {
+	Index      int     // index of the first value after the shift
+	Before     float64 // median of the segment before the shift
+	After      float64 // median of the segment after the shift
+	Confidence float64 // 1 - p-value of the permutation test, in [0, 1)
+}
+
+// Change returns the relative change of the level, in percents.
+func (c *ChangePoint) Change() float64 {
+	if c.Before == 0 {
+		return 0
+	}
+	return 100 * (c.After - c.Before) / c.Before
+}
+
+// ChangePointDetector finds level shifts with E-divisive, a hierarchical
+// divisive algorithm based on energy statistics (Matteson & James, 2014).
+// The sequence is split recursively at the point that maximizes the
+// energy distance between the two sides, for as long as the split is
+// significant according to a permutation test.
+type ChangePointDetector struct {
+	MinSize      int        // min number of values in a segment
+	Confidence   float64    // min confidence of a change point, in (0, 1)
+	Permutations int        // number of permutations in the significance test
+	Rand         *rand.Rand // source of permutations
+}
+
+// Detect returns change points of values, ordered by index.
+func (d *ChangePointDetector) Detect(values []float64) []ChangePoint {
+	bounds := []int{0, len(values)} // sorted segment boundaries
+	confidences := map[int]float64{}
+	for {
+		index, stat := d.bestSplit(values, bounds)
+		if index < 0 {
+			break
+		}
+
+		// Shuffle values within segments and count how often
+		// the best split is at least as good as the observed one.
+		exceeded := 0
+		shuffled := make([]float64, len(values))
+		for i := 0; i < d.Permutations; i++ {
+			copy(shuffled, values)
+			for j := 1; j < len(bounds); j++ {
+				segment := shuffled[bounds[j-1]:bounds[j]]
+				d.Rand.Shuffle(len(segment), func(a, b int) {
+					segment[a], segment[b] = segment[b], segment[a]
+				})
+			}
+			if _, s := d.bestSplit(shuffled, bounds); s >= stat {
+				exceeded++
+			}
+		}
+		pValue := float64(exceeded+1) / float64(d.Permutations+1)
+		if 1-pValue < d.Confidence {
+			break
+		}
+
+		confidences[index] = 1 - pValue
+		bounds = append(bounds, index)
+		sort.Ints(bounds)
+	}
+
+	var points []ChangePoint
+	for j := 1; j < len(bounds)-1; j++ {
+		points = append(points, ChangePoint{
+			Index:      bounds[j],
+			Before:     Median(values[bounds[j-1]:bounds[j]]),
+			After:      Median(values[bounds[j]:bounds[j+1]]),
+			Confidence: confidences[bounds[j]],
+		})
+	}
+	return points
+}
+
+// bestSplit returns the split index with the max energy statistic across
+// all segments delimited by bounds, and the statistic.
+// Returns -1 if no segment can be split.
+func (d *ChangePointDetector) bestSplit(values []float64, bounds []int) (int, float64) {
+	best, bestStat := -1, math.Inf(-1)
+	for j := 1; j < len(bounds); j++ {
+		if index, stat := d.bestSegmentSplit(values, bounds[j-1], bounds[j]); index >= 0 && stat > bestStat {
+			best, bestStat = index, stat
+		}
+	}
+	return best, bestStat
+}
+
+// bestSegmentSplit returns the index in (start, end) that maximizes
+// the energy statistic between values[start:index] and values[index:end],
+// and the statistic. Returns -1 if the segment is too short to split.
+func (d *ChangePointDetector) bestSegmentSplit(values []float64, start, end int) (int, float64) {
+	minSize := d.MinSize
+	if minSize < 1 {
+		minSize = 1
+	}
+	x := values[start:end]
+	n := len(x)
+	if n < 2*minSize {
+		return -1, 0
+	}
+
+	// Sums of pairwise distances within the left side, within the right side
+	// and in total. They are updated as the split moves right.
+	var left, right float64
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			right += math.Abs(x[i] - x[j])
+		}
+	}
+	total := right
+
+	best, bestStat := -1, math.Inf(-1)
+	for k := 1; k <= n-minSize; k++ {
+		// Move x[k-1] from the right side to the left one.
+		for i := 0; i < k-1; i++ {
+			left += math.Abs(x[i] - x[k-1])
+		}
+		for j := k; j < n; j++ {
+			right -= math.Abs(x[k-1] - x[j])
+		}
+		if k < minSize {
+			continue
+		}
+
+		m, r := float64(k), float64(n-k)
+		between := total - left - right
+		stat := 2 * between / (m * r)
+		if k > 1 {
+			stat -= left / (m * (m - 1) / 2)
+		}
+		if n-k > 1 {
+			stat -= right / (r * (r - 1) / 2)
+		}
+		stat *= m * r / (m + r)
+		if stat > bestStat {
+			best, bestStat = start+k, stat
+		}
+	}
+	return best, bestStat
+}
+
+// Median returns the median of values.
+func Median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
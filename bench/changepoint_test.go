@@ -0,0 +1,128 @@
+package bench
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// level returns n values around v with a small deterministic noise.
+func level(v float64, n int) []float64 {
+	noise := []float64{0, 0.3, -0.2, 0.1, -0.3, 0.2}
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = v + noise[i%len(noise)]
+	}
+	return values
+}
+
+// concat concatenates slices of values.
+func concat(slices ...[]float64) []float64 {
+	var result []float64
+	for _, s := range slices {
+		result = append(result, s...)
+	}
+	return result
+}
+
+func TestChangePointDetector(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		values  []float64
+		indexes []int
+	}{
+		{"no change", level(10, 20), nil},
+		{"constant", []float64{5, 5, 5, 5, 5, 5}, nil},
+		{"single step", concat(level(10, 10), level(20, 10)), []int{10}},
+		{"two steps", concat(level(10, 8), level(20, 8), level(30, 8)), []int{8, 16}},
+		{"too short", []float64{10, 20, 30}, nil},
+		{"empty", nil, nil},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			d := &ChangePointDetector{
+				MinSize:      2,
+				Confidence:   0.95,
+				Permutations: 199,
+				Rand:         rand.New(rand.NewSource(1)),
+			}
+			var indexes []int
+			for _, p := range d.Detect(c.values) {
+				indexes = append(indexes, p.Index)
+				if p.Confidence < d.Confidence {
+					t.Errorf("change point %+v has confidence below %g", p, d.Confidence)
+				}
+			}
+			if !reflect.DeepEqual(indexes, c.indexes) {
+				t.Errorf("got change points at %v, want %v", indexes, c.indexes)
+			}
+		})
+	}
+}
+
+func TestChangePointLevels(t *testing.T) {
+	d := &ChangePointDetector{MinSize: 2, Confidence: 0.95, Permutations: 199, Rand: rand.New(rand.NewSource(1))}
+	points := d.Detect(concat(level(10, 10), level(20, 10)))
+	if len(points) != 1 {
+		t.Fatalf("got %d change points, want 1", len(points))
+	}
+	p := points[0]
+	if p.Before != 10.05 || p.After != 20.05 {
+		t.Errorf("got levels %g → %g, want 10.05 → 20.05", p.Before, p.After)
+	}
+	if got := p.Change(); math.Abs(got-99.5) > 0.01 {
+		t.Errorf("got change %.2f%%, want 99.50%%", got)
+	}
+}
+
+// energyStatistic computes the statistic of a split of x at k from scratch.
+func energyStatistic(x []float64, k int) float64 {
+	mean := func(a, b []float64, skipSame bool) float64 {
+		var sum float64
+		var count int
+		for i := range a {
+			for j := range b {
+				if skipSame && j <= i {
+					continue
+				}
+				sum += math.Abs(a[i] - b[j])
+				count++
+			}
+		}
+		if count == 0 {
+			return 0
+		}
+		return sum / float64(count)
+	}
+	left, right := x[:k], x[k:]
+	m, r := float64(len(left)), float64(len(right))
+	stat := 2*mean(left, right, false) - mean(left, left, true) - mean(right, right, true)
+	return stat * m * r / (m + r)
+}
+
+func TestBestSegmentSplit(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	x := make([]float64, 15)
+	for i := range x {
+		x[i] = rnd.Float64() * 10
+	}
+	values := concat([]float64{100, 200}, x, []float64{300}) // the segment is values[2:17]
+
+	for _, minSize := range []int{1, 2, 4} {
+		d := &ChangePointDetector{MinSize: minSize}
+		wantIndex, wantStat := -1, math.Inf(-1)
+		for k := minSize; k <= len(x)-minSize; k++ {
+			if s := energyStatistic(x, k); s > wantStat {
+				wantIndex, wantStat = 2+k, s
+			}
+		}
+		index, stat := d.bestSegmentSplit(values, 2, 17)
+		if index != wantIndex || math.Abs(stat-wantStat) > 1e-9 {
+			t.Errorf("min size %d: got split at %d with %g, want %d with %g", minSize, index, stat, wantIndex, wantStat)
+		}
+	}
+
+	if index, _ := (&ChangePointDetector{MinSize: 3}).bestSegmentSplit(values, 0, 5); index != -1 {
+		t.Errorf("a segment shorter than 2*MinSize was split at %d", index)
+	}
+}
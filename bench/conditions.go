@@ -0,0 +1,85 @@
+package bench
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// highLoadPerCPU is the 1-minute load average per CPU above which
+// benchmark results are considered noisy.
+const highLoadPerCPU = 0.75
+
+// Conditions describe the system while benchmarks ran,
+// so that noisy results can be identified later.
+type Conditions struct {
+	PinnedCPUs  string   `json:",omitempty"` // CPUs the test process was pinned to, e.g. "2-3"
+	Governors   []string `json:",omitempty"` // distinct CPU frequency governors of the CPUs
+	LoadAverage float64  // 1-minute load average before the run
+	NumCPU      int      // number of CPUs available to ggt
+}
+
+// NoiseWarnings returns descriptions of conditions that may make results noisy,
+// keyed by kind.
+func (c *Conditions) NoiseWarnings() map[string]string {
+	warnings := map[string]string{}
+	var slow []string
+	for _, g := range c.Governors {
+		if g != "performance" {
+			slow = append(slow, g)
+		}
+	}
+	if len(slow) > 0 {
+		warnings["governor"] = fmt.Sprintf("CPU frequency governor is %s, not performance", strings.Join(slow, ", "))
+	}
+	if c.NumCPU > 0 && c.LoadAverage > highLoadPerCPU*float64(c.NumCPU) {
+		warnings["load"] = fmt.Sprintf("load average is %.2f, more than %.2f per CPU", c.LoadAverage, highLoadPerCPU)
+	}
+	return warnings
+}
+
+// CPUList is a flag.Value of CPU numbers in taskset -c format, e.g. "0-3,6".
+type CPUList []int
+
+func (l *CPUList) String() string {
+	var parts []string
+	cpus := *l
+	for i := 0; i < len(cpus); {
+		j := i
+		for j+1 < len(cpus) && cpus[j+1] == cpus[j]+1 {
+			j++
+		}
+		if j > i {
+			parts = append(parts, fmt.Sprintf("%d-%d", cpus[i], cpus[j]))
+		} else {
+			parts = append(parts, strconv.Itoa(cpus[i]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
+
+func (l *CPUList) Set(value string) error {
+	seen := map[int]bool{}
+	for _, part := range strings.Split(value, ",") {
+		first, last := part, part
+		if i := strings.Index(part, "-"); i >= 0 {
+			first, last = part[:i], part[i+1:]
+		}
+		from, err1 := strconv.Atoi(first)
+		to, err2 := strconv.Atoi(last)
+		if err1 != nil || err2 != nil || from < 0 || to < from {
+			return fmt.Errorf("invalid CPU list %q", value)
+		}
+		for cpu := from; cpu <= to; cpu++ {
+			seen[cpu] = true
+		}
+	}
+	*l = (*l)[:0]
+	for cpu := range seen {
+		*l = append(*l, cpu)
+	}
+	sort.Ints(*l)
+	return nil
+}
@@ -0,0 +1,149 @@
+package bench
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// PinningSupported is true if StartPinned can pin processes to CPUs.
+const PinningSupported = true
+
+// cpuSetSize is the max number of CPUs in a cpuSet.
+const cpuSetSize = 1024
+
+// cpuSet is a CPU mask of sched_setaffinity.
+type cpuSet [cpuSetSize / 64]uint64
+
+// schedAffinity gets or sets CPU affinity of the current thread to set.
+// trap is SYS_SCHED_GETAFFINITY or SYS_SCHED_SETAFFINITY.
+func schedAffinity(trap uintptr, set *cpuSet) error {
+	_, _, errno := syscall.RawSyscall(trap, 0, unsafe.Sizeof(*set), uintptr(unsafe.Pointer(set)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// StartPinned starts cmd with CPU affinity limited to cpus.
+// A child process inherits affinity of the thread that forks it,
+// so affinity of the current thread is changed while cmd starts.
+func StartPinned(cmd *exec.Cmd, cpus []int) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	var old, pinned cpuSet
+	if err := schedAffinity(syscall.SYS_SCHED_GETAFFINITY, &old); err != nil {
+		return fmt.Errorf("could not get CPU affinity: %s", err)
+	}
+	for _, cpu := range cpus {
+		if cpu >= cpuSetSize {
+			return fmt.Errorf("CPU %d is out of range", cpu)
+		}
+		pinned[cpu/64] |= 1 << uint(cpu%64)
+	}
+	if err := schedAffinity(syscall.SYS_SCHED_SETAFFINITY, &pinned); err != nil {
+		return fmt.Errorf("could not pin to CPUs %s: %s", (*CPUList)(&cpus), err)
+	}
+	defer schedAffinity(syscall.SYS_SCHED_SETAFFINITY, &old)
+	return cmd.Start()
+}
+
+// MemoryLimitSupported is true if TestBinaryMemory can measure memory of processes.
+const MemoryLimitSupported = true
+
+// TestBinaryMemory returns the total resident memory, in bytes, of the
+// processes in process group pgid whose executable name ends with ".test",
+// i.e. test binaries, but not go, the compiler or the linker that build them.
+func TestBinaryMemory(pgid int) (int64, error) {
+	proc, err := os.Open("/proc")
+	if err != nil {
+		return 0, err
+	}
+	names, err := proc.Readdirnames(-1)
+	proc.Close()
+	if err != nil {
+		return 0, err
+	}
+	group := strconv.Itoa(pgid)
+	var total int64
+	for _, name := range names {
+		if _, err := strconv.Atoi(name); err != nil {
+			continue
+		}
+		// Processes may exit while they are read.
+		stat, err := ioutil.ReadFile(filepath.Join("/proc", name, "stat"))
+		if err != nil {
+			continue
+		}
+		// The command name in parentheses may contain spaces, so fields
+		// are counted after it, starting from the 3rd one, state.
+		s := string(stat)
+		fields := strings.Fields(s[strings.LastIndexByte(s, ')')+1:])
+		if len(fields) < 22 || fields[2] != group {
+			continue
+		}
+		// The command name is truncated to 15 bytes, so the executable
+		// is read from the command line.
+		cmdline, err := ioutil.ReadFile(filepath.Join("/proc", name, "cmdline"))
+		if err != nil {
+			continue
+		}
+		if exe := strings.SplitN(string(cmdline), "\x00", 2)[0]; !strings.HasSuffix(exe, ".test") {
+			continue
+		}
+		pages, err := strconv.ParseInt(fields[21], 10, 64)
+		if err != nil {
+			continue
+		}
+		total += pages * int64(os.Getpagesize())
+	}
+	return total, nil
+}
+
+// ReadConditions reads load average and CPU frequency governors
+// of cpus, or of all CPUs if cpus is empty.
+// cpus are the CPUs benchmarks are pinned to.
+func ReadConditions(cpus []int) *Conditions {
+	c := &Conditions{NumCPU: runtime.NumCPU()}
+	if len(cpus) > 0 {
+		c.PinnedCPUs = (*CPUList)(&cpus).String()
+	}
+	if data, err := ioutil.ReadFile("/proc/loadavg"); err == nil {
+		if fields := strings.Fields(string(data)); len(fields) > 0 {
+			c.LoadAverage, _ = strconv.ParseFloat(fields[0], 64)
+		}
+	}
+
+	var files []string
+	if len(cpus) == 0 {
+		// No cpufreq in most VMs and containers.
+		files, _ = filepath.Glob("/sys/devices/system/cpu/cpu[0-9]*/cpufreq/scaling_governor")
+	}
+	for _, cpu := range cpus {
+		files = append(files, fmt.Sprintf("/sys/devices/system/cpu/cpu%d/cpufreq/scaling_governor", cpu))
+	}
+	governors := map[string]bool{}
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		if g := strings.TrimSpace(string(data)); g != "" {
+			governors[g] = true
+		}
+	}
+	for g := range governors {
+		c.Governors = append(c.Governors, g)
+	}
+	sort.Strings(c.Governors)
+	return c
+}
@@ -0,0 +1,36 @@
+//go:build !linux
+// +build !linux
+
+package bench
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// PinningSupported is true if StartPinned can pin processes to CPUs.
+const PinningSupported = false
+
+// StartPinned returns an error, CPU pinning is supported only on Linux.
+func StartPinned(cmd *exec.Cmd, cpus []int) error {
+	return fmt.Errorf("CPU pinning is supported only on Linux")
+}
+
+// MemoryLimitSupported is true if TestBinaryMemory can measure memory of processes.
+const MemoryLimitSupported = false
+
+// TestBinaryMemory returns an error, memory limits are supported only on Linux.
+func TestBinaryMemory(pgid int) (int64, error) {
+	return 0, fmt.Errorf("memory limits are supported only on Linux")
+}
+
+// ReadConditions returns the number of CPUs.
+// Load average and CPU frequency governors are read only on Linux.
+func ReadConditions(cpus []int) *Conditions {
+	c := &Conditions{NumCPU: runtime.NumCPU()}
+	if len(cpus) > 0 {
+		c.PinnedCPUs = (*CPUList)(&cpus).String()
+	}
+	return c
+}
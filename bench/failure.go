@@ -0,0 +1,79 @@
+package bench
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+// TestFailedError is returned when `go test` exits with a non-zero code
+// or exceeds a limit.
+// It is stored in the cache, so ExitCode is not persisted.
+type TestFailedError struct {
+	ExitCode     int  `json:"-"`
+	BuildFailed  bool // true if the package or its tests could not be built
+	StderrOutput []byte
+	StdoutOutput []byte // stdout lines that are not benchmark results
+
+	// Exceeded is the kind of the limit that the run exceeded, e.g.
+	// ExceededTimeout. Empty if the run did not exceed limits.
+	Exceeded string `json:",omitempty"`
+	// Limits are limits of the run that exceeded one.
+	Limits *Limits `json:",omitempty"`
+}
+
+func (e *TestFailedError) Error() string {
+	switch {
+	case e.Exceeded != "" && e.Limits != nil:
+		return e.Limits.Describe(e.Exceeded)
+	case e.BuildFailed:
+		return "build failed"
+	default:
+		return "test failed"
+	}
+}
+
+// Excerpt returns at most maxLines last non-empty lines of the test output.
+// Prefers stderr, which contains compilation errors, over stdout.
+func (e *TestFailedError) Excerpt(maxLines int) []string {
+	output := e.StderrOutput
+	if len(bytes.TrimSpace(output)) == 0 {
+		output = e.StdoutOutput
+	}
+	var lines []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > maxLines {
+		lines = lines[len(lines)-maxLines:]
+	}
+	return lines
+}
+
+// buildFailedRegex matches a line that go test prints if a package could not be built.
+var buildFailedRegex = regexp.MustCompile(`\[(build|setup) failed\]\s*$`)
+
+// NewTestFailedError converts err returned by a `go test` run to *TestFailedError
+// if err has ExitCode() int method, like *exec.ExitError, or ExceededLimit() string
+// method. Otherwise returns err as is. Limits must be set by the caller.
+func NewTestFailedError(err error, stdout, stderr []byte) error {
+	if limit, ok := err.(interface{ ExceededLimit() string }); ok {
+		return &TestFailedError{
+			Exceeded:     limit.ExceededLimit(),
+			StderrOutput: stderr,
+			StdoutOutput: stdout,
+		}
+	}
+	exit, ok := err.(interface{ ExitCode() int })
+	if !ok {
+		return err
+	}
+	return &TestFailedError{
+		ExitCode:     exit.ExitCode(),
+		BuildFailed:  buildFailedRegex.Match(stdout) || bytes.HasPrefix(stderr, []byte("# ")),
+		StderrOutput: stderr,
+		StdoutOutput: stdout,
+	}
+}
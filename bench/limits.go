@@ -0,0 +1,103 @@
+package bench
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kinds of limits a run can exceed, see TestFailedError.Exceeded.
+const (
+	ExceededTimeout          = "timeout"
+	ExceededBenchmarkTimeout = "benchmark timeout"
+	ExceededMemory           = "memory"
+)
+
+// Limits are resource limits of benchmark runs. Zero values mean no limit.
+type Limits struct {
+	// Timeout is the max duration of a `go test` run of a package,
+	// including the build.
+	Timeout time.Duration
+	// BenchmarkTimeout is the max duration of a benchmark, measured as the
+	// time between outputs of the test binary.
+	BenchmarkTimeout time.Duration
+	// Memory is the max resident memory of the test binaries of a run,
+	// checked periodically. The build is not limited.
+	// Supported only on Linux, see MemoryLimitSupported.
+	Memory ByteSize
+}
+
+// Describe describes the limit of the given kind.
+func (l *Limits) Describe(kind string) string {
+	switch kind {
+	case ExceededTimeout:
+		return "timed out after " + l.Timeout.String()
+	case ExceededBenchmarkTimeout:
+		return "benchmark timed out after " + l.BenchmarkTimeout.String()
+	case ExceededMemory:
+		return "out of memory, limit " + l.Memory.String()
+	default:
+		return "exceeded " + kind
+	}
+}
+
+// Raised returns true if the limit of the given kind is higher in l than in old,
+// so a run that exceeded old may succeed with l.
+func (l *Limits) Raised(old *Limits, kind string) bool {
+	raised := func(new, old int64) bool {
+		return old != 0 && (new == 0 || new > old)
+	}
+	switch kind {
+	case ExceededTimeout:
+		return raised(int64(l.Timeout), int64(old.Timeout))
+	case ExceededBenchmarkTimeout:
+		return raised(int64(l.BenchmarkTimeout), int64(old.BenchmarkTimeout))
+	case ExceededMemory:
+		return raised(int64(l.Memory), int64(old.Memory))
+	default:
+		return false
+	}
+}
+
+// ByteSize is a flag.Value of a number of bytes with an optional unit,
+// e.g. 512MiB, 2GB or 2G. Units are powers of 1024.
+type ByteSize int64
+
+// byteUnits are units of ByteSize, largest first.
+var byteUnits = []struct {
+	suffixes []string
+	size     int64
+}{
+	{[]string{"TiB", "TB", "T"}, 1 << 40},
+	{[]string{"GiB", "GB", "G"}, 1 << 30},
+	{[]string{"MiB", "MB", "M"}, 1 << 20},
+	{[]string{"KiB", "KB", "K"}, 1 << 10},
+	{[]string{"B", ""}, 1},
+}
+
+func (b *ByteSize) String() string {
+	for _, u := range byteUnits {
+		if *b != 0 && int64(*b)%u.size == 0 {
+			return strconv.FormatInt(int64(*b)/u.size, 10) + u.suffixes[0]
+		}
+	}
+	return "0"
+}
+
+func (b *ByteSize) Set(value string) error {
+	for _, u := range byteUnits {
+		for _, suffix := range u.suffixes {
+			if !strings.HasSuffix(value, suffix) {
+				continue
+			}
+			n, err := strconv.ParseFloat(strings.TrimSuffix(value, suffix), 64)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid size %q", value)
+			}
+			*b = ByteSize(n * float64(u.size))
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid size %q", value)
+}
@@ -0,0 +1,121 @@
+package bench
+
+import (
+	"math"
+	"sort"
+
+	"github.com/google/pprof/profile"
+)
+
+// FunctionTime is time spent in a function per benchmark op,
+// estimated from a CPU profile.
+type FunctionTime struct {
+	File string  // path of the source file at the time of profiling
+	Flat float64 // ns/op spent in the function itself
+	Cum  float64 // ns/op spent in the function and its callees
+}
+
+// FunctionTimes returns time spent in each function sampled in p,
+// keyed by function name. Names are qualified with import paths,
+// so they identify functions across profiles of different checkouts.
+// Samples are assumed to be spread evenly over ops of a benchmark that
+// took nsPerOp, so the time of a function is its share of all samples
+// times nsPerOp. The default sample type of p is used, e.g. cpu for CPU profiles.
+func FunctionTimes(p *profile.Profile, nsPerOp float64) map[string]FunctionTime {
+	valueIndex := len(p.SampleType) - 1
+	for i, t := range p.SampleType {
+		if t.Type == p.DefaultSampleType {
+			valueIndex = i
+		}
+	}
+
+	var total int64
+	flat := map[string]int64{}
+	cum := map[string]int64{}
+	files := map[string]string{}
+	for _, s := range p.Sample {
+		v := s.Value[valueIndex]
+		total += v
+		// A function that recurses or is inlined several times
+		// counts once in the cumulative time of a sample.
+		seen := map[string]bool{}
+		for i, loc := range s.Location {
+			// Lines of a location are ordered from the innermost inlined function.
+			for j, line := range loc.Line {
+				if line.Function == nil {
+					continue
+				}
+				f := line.Function.Name
+				files[f] = line.Function.Filename
+				if i == 0 && j == 0 {
+					flat[f] += v
+				}
+				if !seen[f] {
+					seen[f] = true
+					cum[f] += v
+				}
+			}
+		}
+	}
+
+	times := make(map[string]FunctionTime, len(cum))
+	if total == 0 {
+		return times
+	}
+	for f, c := range cum {
+		times[f] = FunctionTime{
+			File: files[f],
+			Flat: nsPerOp * float64(flat[f]) / float64(total),
+			Cum:  nsPerOp * float64(c) / float64(total),
+		}
+	}
+	return times
+}
+
+// FunctionChange is a change of time spent in a function.
+type FunctionChange struct {
+	Name     string
+	File     string // path of the source file in the new profile, or the old one if absent
+	Old, New FunctionTime
+}
+
+// Flat returns the change of flat time in ns/op.
+func (c *FunctionChange) Flat() float64 {
+	return c.New.Flat - c.Old.Flat
+}
+
+// Cum returns the change of cumulative time in ns/op.
+func (c *FunctionChange) Cum() float64 {
+	return c.New.Cum - c.Old.Cum
+}
+
+// DiffFunctionTimes returns changes of functions present in old or new,
+// ordered by the absolute change of flat time, or cumulative time if byCum,
+// largest first.
+func DiffFunctionTimes(old, new map[string]FunctionTime, byCum bool) []FunctionChange {
+	changes := make([]FunctionChange, 0, len(new))
+	for f, t := range new {
+		changes = append(changes, FunctionChange{Name: f, File: t.File, Old: old[f], New: t})
+	}
+	for f, t := range old {
+		if _, ok := new[f]; !ok {
+			changes = append(changes, FunctionChange{Name: f, File: t.File, Old: t})
+		}
+	}
+
+	key := func(c *FunctionChange) float64 {
+		if byCum {
+			return math.Abs(c.Cum())
+		}
+		return math.Abs(c.Flat())
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		a, b := &changes[i], &changes[j]
+		if ka, kb := key(a), key(b); ka != kb {
+			return ka > kb
+		}
+		// Ties are common among unchanged functions; order them deterministically.
+		return a.Name < b.Name
+	})
+	return changes
+}
@@ -0,0 +1,192 @@
+// Package bench parses, stores and analyzes results of `go test -bench`.
+package bench
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var runLineRegex = regexp.MustCompile(`^\s*(Benchmark[^\- ]*)(-\d+)?\s+(\d+)\s+(\d*(\.\d+)?) ns/op((\s+\S+ \S+)*)\s*$`)
+
+// metricRegex matches additional metrics reported by -benchmem and b.SetBytes.
+var metricRegex = regexp.MustCompile(`(\d*(\.\d+)?) (B/op|allocs/op|MB/s)`)
+
+// Run contains number of iterations and speed.
+type Run struct {
+	Line          string  // output of go test that this run was parsed from.
+	Name          string  // test name
+	N             int     // number of iterations
+	NsPerOp       float32 // number of nanoseconds per iteration
+	NsPerOpChange float32 // percentage of increase
+
+	BytesPerOp  int64   // bytes allocated per iteration, reported with -benchmem
+	AllocsPerOp int64   // allocations per iteration, reported with -benchmem
+	MemReported bool    // true if BytesPerOp and AllocsPerOp were reported
+	MBPerS      float32 // throughput, reported if the benchmark calls b.SetBytes
+
+	Conditions *Conditions   `json:",omitempty"` // system conditions of the run
+	Duration   time.Duration `json:",omitempty"` // wall time of the run, excluding the build. 0 if unknown.
+
+	// Interleaved are samples of runs interleaved with runs of another git
+	// tree, keyed by its id, see repo.PackageSet.Interleave. Samples are
+	// compared only with samples of the other tree from the same
+	// interleaving, so NsPerOp does not include them.
+	Interleaved map[string]*Samples `json:",omitempty"`
+}
+
+// Samples are results of interleaved runs of a benchmark.
+type Samples struct {
+	NsPerOp    []float32
+	Conditions []*Conditions `json:",omitempty"` // conditions of each sample
+}
+
+// ParseRun parses a Run from `go test` output line.
+// Returns nil if cannot parse.
+func ParseRun(line string) *Run {
+	line = strings.TrimSpace(line)
+	groups := runLineRegex.FindStringSubmatch(line)
+	if len(groups) == 0 {
+		return nil
+	}
+
+	n, err := strconv.Atoi(groups[3])
+	if err != nil {
+		panic(err)
+	}
+
+	nsop, err := strconv.ParseFloat(groups[4], 32)
+	if err != nil {
+		panic(err)
+	}
+	r := &Run{
+		Line:    line,
+		Name:    groups[1],
+		N:       n,
+		NsPerOp: float32(nsop),
+	}
+	for _, m := range metricRegex.FindAllStringSubmatch(groups[6], -1) {
+		value, err := strconv.ParseFloat(m[1], 64)
+		if err != nil {
+			continue
+		}
+		switch m[3] {
+		case "B/op":
+			r.BytesPerOp = int64(value)
+			r.MemReported = true
+		case "allocs/op":
+			r.AllocsPerOp = int64(value)
+			r.MemReported = true
+		case "MB/s":
+			r.MBPerS = float32(value)
+		}
+	}
+	return r
+}
+
+// Annotate computes r.NsPerOpChange relative to prev.
+func (r *Run) Annotate(prev *Run) {
+	if r.NsPerOp == prev.NsPerOp {
+		r.NsPerOpChange = 0
+	} else {
+		r.NsPerOpChange = 100 * (r.NsPerOp - prev.NsPerOp) / prev.NsPerOp
+	}
+}
+
+// SetInterleaved records runs interleaved with runs of the tree treeId,
+// replacing samples of a previous interleaving with it.
+func (r *Run) SetInterleaved(treeId string, runs []*Run) {
+	samples := &Samples{}
+	for _, run := range runs {
+		samples.NsPerOp = append(samples.NsPerOp, run.NsPerOp)
+		samples.Conditions = append(samples.Conditions, run.Conditions)
+	}
+	// Copies of r share the map, so it is not modified in place.
+	interleaved := make(map[string]*Samples, len(r.Interleaved)+1)
+	for id, s := range r.Interleaved {
+		interleaved[id] = s
+	}
+	interleaved[treeId] = samples
+	r.Interleaved = interleaved
+}
+
+// InterleavedWith returns a copy of r whose NsPerOp is the median of samples
+// interleaved with runs of the tree treeId, or nil if there are none.
+func (r *Run) InterleavedWith(treeId string) *Run {
+	samples := r.Interleaved[treeId]
+	if samples == nil || len(samples.NsPerOp) == 0 {
+		return nil
+	}
+	values := make([]float64, len(samples.NsPerOp))
+	for i, ns := range samples.NsPerOp {
+		values[i] = float64(ns)
+	}
+	c := *r
+	c.NsPerOp = float32(Median(values))
+	return &c
+}
+
+// String returns the original text output line, annotated with r.NsPerOpChange.
+func (r *Run) String() string {
+	result := r.Line
+	if r.NsPerOpChange != 0 {
+		result += fmt.Sprintf("\t%+f%%", r.NsPerOpChange)
+	}
+	return result
+}
+
+// RunSlice is a sorted slice of Run
+type RunSlice []Run
+
+func (s RunSlice) Len() int {
+	return len(s)
+}
+
+func (s RunSlice) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+func (s RunSlice) Less(i, j int) bool {
+	return s[i].Name < s[j].Name
+}
+
+// Search returns the index of the benchmark name in s,
+// or the index to insert it at.
+func (s RunSlice) Search(name string) int {
+	return sort.Search(len(s), func(i int) bool {
+		return s[i].Name >= name
+	})
+}
+
+// Find searches for a benchmark by name.
+func (s RunSlice) Find(name string) *Run {
+	i := s.Search(name)
+	if i < len(s) && s[i].Name == name {
+		return &s[i]
+	}
+	return nil
+}
+
+// Add inserts benchmark to s and keeps it sorted.
+// Returns error if a benchmark of the same already exists in s.
+func (s *RunSlice) Add(benchmark *Run) error {
+	sv := *s
+	i := s.Search(benchmark.Name)
+	if i < len(sv) && sv[i].Name == benchmark.Name {
+		return fmt.Errorf("Benchmark %s with this name is already present", benchmark.Name)
+	}
+	*s = append(sv[:i], append([]Run{*benchmark}, sv[i:]...)...)
+	return nil
+}
+
+// Put inserts benchmark to s, or replaces a benchmark of the same name.
+func (s *RunSlice) Put(benchmark *Run) {
+	if existing := s.Find(benchmark.Name); existing != nil {
+		*existing = *benchmark
+		return
+	}
+	s.Add(benchmark)
+}
@@ -0,0 +1,140 @@
+package bench
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Series is a named build configuration. Results of different series
+// of the same revision are stored and compared separately.
+type Series struct {
+	Name     string // e.g. "cpu=4 tags=purego". Empty if there is only one series.
+	Settings Settings
+}
+
+// Matrix describes series to run for each revision.
+// Series are the cross product of all dimensions.
+type Matrix struct {
+	CPUs    string   // comma-separated -cpu values
+	TagSets []string // -tags values; empty string means no tags
+	EnvSets []string // space-separated environment variables
+}
+
+// Series expands m into a list of series based on base.
+// Returns one unnamed series with base settings if m is empty.
+func (m *Matrix) Series(base Settings) []Series {
+	result := []Series{{Settings: base}}
+	expand := func(values []string, apply func(s *Series, value string)) {
+		if len(values) == 0 {
+			return
+		}
+		var expanded []Series
+		for _, s := range result {
+			for _, v := range values {
+				c := s
+				// appending to clipped slices does not affect other series.
+				c.Settings.TestFlags = clip(s.Settings.TestFlags)
+				c.Settings.Env = clip(s.Settings.Env)
+				apply(&c, v)
+				expanded = append(expanded, c)
+			}
+		}
+		result = expanded
+	}
+	addName := func(s *Series, name string) {
+		s.Name = strings.TrimSpace(s.Name + " " + name)
+	}
+
+	var cpus []string
+	if m.CPUs != "" {
+		cpus = strings.Split(m.CPUs, ",")
+	}
+	expand(cpus, func(s *Series, cpu string) {
+		s.Settings.TestFlags = append(s.Settings.TestFlags, "-cpu="+cpu)
+		addName(s, "cpu="+cpu)
+	})
+	expand(m.TagSets, func(s *Series, tags string) {
+		if tags != "" {
+			s.Settings.TestFlags = append(s.Settings.TestFlags, "-tags="+tags)
+		}
+		addName(s, "tags="+tags)
+	})
+	expand(m.EnvSets, func(s *Series, env string) {
+		s.Settings.Env = append(s.Settings.Env, strings.Fields(env)...)
+		addName(s, env)
+	})
+	return result
+}
+
+// Validate returns an error if m has invalid values.
+func (m *Matrix) Validate() error {
+	if m.CPUs != "" {
+		for _, cpu := range strings.Split(m.CPUs, ",") {
+			if n, err := strconv.Atoi(cpu); err != nil || n <= 0 {
+				return fmt.Errorf("invalid -cpu value %q", cpu)
+			}
+		}
+	}
+	return nil
+}
+
+// Results are benchmark results of one revision in each series.
+// A package that failed in a series has a failure instead of benchmarks.
+type Results struct {
+	Benchmarks []map[string]RunSlice         // {relPackagePath -> benchmarks} for each series
+	Failures   []map[string]*TestFailedError // {relPackagePath -> failure} for each series
+}
+
+// NewResults returns empty results of seriesCount series.
+func NewResults(seriesCount int) *Results {
+	r := &Results{
+		Benchmarks: make([]map[string]RunSlice, seriesCount),
+		Failures:   make([]map[string]*TestFailedError, seriesCount),
+	}
+	for i := 0; i < seriesCount; i++ {
+		r.Benchmarks[i] = map[string]RunSlice{}
+		r.Failures[i] = map[string]*TestFailedError{}
+	}
+	return r
+}
+
+// HasFailures returns true if any package failed in any series.
+func (r *Results) HasFailures() bool {
+	for _, f := range r.Failures {
+		if len(f) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// AllFailed returns true if all packages failed in all series.
+func (r *Results) AllFailed() bool {
+	for _, b := range r.Benchmarks {
+		if len(b) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// BaselineFunc returns the benchmark run to compare a benchmark with,
+// and a label that describes where it comes from. Label is empty
+// for the default baseline. Returns nil if there is nothing to compare with.
+type BaselineFunc func(series int, relPackagePath, name string) (prev *Run, label string)
+
+// Baseline returns a BaselineFunc that compares benchmarks with r.
+func (r *Results) Baseline() BaselineFunc {
+	return func(series int, relPackagePath, name string) (*Run, string) {
+		return r.Benchmarks[series][relPackagePath].Find(name), ""
+	}
+}
+
+// ScalingRatio returns how many times r is faster than base.
+func ScalingRatio(base, r *Run) float64 {
+	if r.NsPerOp == 0 {
+		return 0
+	}
+	return float64(base.NsPerOp / r.NsPerOp)
+}
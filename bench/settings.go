@@ -0,0 +1,188 @@
+package bench
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Settings configures every `go test` invocation for a package set.
+type Settings struct {
+	TestFlags []string // extra `go test` flags, e.g. -benchtime=3s or -tags=purego
+	Env       []string // extra environment variables, e.g. GOGC=off
+
+	GoCmd     string // go binary to use. Defaults to "go" in $PATH or $GOROOT/bin/go.
+	GoRoot    string // GOROOT of the toolchain. Empty to use GOROOT of GoCmd.
+	GoVersion string // output of `go version` of the toolchain, set by ResolveToolchain.
+}
+
+// HasToolchain returns true if the toolchain was configured explicitly.
+func (s *Settings) HasToolchain() bool {
+	return s.GoCmd != "" || s.GoRoot != ""
+}
+
+// GoCommand returns the go binary to run.
+func (s *Settings) GoCommand() string {
+	switch {
+	case s.GoCmd != "":
+		return s.GoCmd
+	case s.GoRoot != "":
+		return filepath.Join(s.GoRoot, "bin", "go")
+	default:
+		return "go"
+	}
+}
+
+// SetToolchain configures the toolchain from spec, which is either
+// a GOROOT directory or a go binary name or path, e.g. go1.21.0.
+func (s *Settings) SetToolchain(spec string) {
+	s.GoCmd, s.GoRoot = "", ""
+	if fi, err := os.Stat(spec); err == nil && fi.IsDir() {
+		s.GoRoot = spec
+	} else {
+		s.GoCmd = spec
+	}
+}
+
+// ResolveToolchain sets s.GoVersion by running `go version`.
+// Does nothing if the toolchain is not configured explicitly.
+func (s *Settings) ResolveToolchain() error {
+	if !s.HasToolchain() || s.GoVersion != "" {
+		return nil
+	}
+	cmd := exec.Command(s.GoCommand(), "version")
+	if s.GoRoot != "" {
+		cmd.Env = append(os.Environ(), "GOROOT="+s.GoRoot)
+	}
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("could not determine version of toolchain %s: %s", s.GoCommand(), err)
+	}
+	s.GoVersion = strings.TrimPrefix(strings.TrimSpace(string(out)), "go version ")
+	return nil
+}
+
+// GoEnv returns environment variables that select the toolchain.
+func (s *Settings) GoEnv() []string {
+	if !s.HasToolchain() {
+		return nil
+	}
+	// Do not let the go command switch to a toolchain required by go.mod.
+	env := []string{"GOTOOLCHAIN=local"}
+	if s.GoRoot != "" {
+		env = append(env, "GOROOT="+s.GoRoot)
+	}
+	return env
+}
+
+// reservedTestFlags are controlled by ggt and cannot be passed through.
+var reservedTestFlags = []string{"run", "bench", "json", "v", "count", "o", "c"}
+
+// testBinaryFlags are `go test` flags that are handled by the test binary.
+var testBinaryFlags = []string{
+	"benchmem", "benchtime", "blockprofile", "blockprofilerate", "cpu", "cpuprofile",
+	"failfast", "memprofile", "memprofilerate", "mutexprofile", "mutexprofilefraction",
+	"outputdir", "parallel", "short", "shuffle", "timeout", "trace",
+}
+
+// TestBinaryArgs returns TestFlags that are handled by the test binary,
+// in -test.name form expected by a binary built with `go test -c`.
+func (s *Settings) TestBinaryArgs() []string {
+	var args []string
+	for _, f := range s.TestFlags {
+		flag := strings.TrimPrefix(strings.TrimLeft(f, "-"), "test.")
+		name := flag
+		if i := strings.Index(name, "="); i >= 0 {
+			name = name[:i]
+		}
+		if containsString(testBinaryFlags, name) {
+			args = append(args, "-test."+flag)
+		}
+	}
+	return args
+}
+
+// Validate returns an error if s contains flags or variables ggt cannot handle.
+func (s *Settings) Validate() error {
+	for _, f := range s.TestFlags {
+		if !strings.HasPrefix(f, "-") {
+			return fmt.Errorf("test flag %q does not start with '-'", f)
+		}
+		name := strings.TrimPrefix(strings.TrimLeft(f, "-"), "test.")
+		value := ""
+		if i := strings.Index(name, "="); i >= 0 {
+			name, value = name[:i], name[i+1:]
+		}
+		if containsString(reservedTestFlags, name) {
+			return fmt.Errorf("test flag %s is controlled by ggt", f)
+		}
+		if name == "cpu" && strings.Contains(value, ",") {
+			// go test would report the same benchmark several times.
+			return fmt.Errorf("test flag %s: only one -cpu value is supported", f)
+		}
+	}
+	for _, e := range s.Env {
+		if !strings.Contains(e, "=") {
+			return fmt.Errorf("environment variable %q is not in KEY=VALUE form", e)
+		}
+	}
+	if s.GoRoot != "" {
+		if fi, err := os.Stat(s.GoRoot); err != nil || !fi.IsDir() {
+			return fmt.Errorf("GOROOT %s is not a directory", s.GoRoot)
+		}
+	}
+	return nil
+}
+
+// IsDefault returns true if s does not change `go test` behavior.
+func (s *Settings) IsDefault() bool {
+	return len(s.TestFlags) == 0 && len(s.Env) == 0 && !s.HasToolchain()
+}
+
+// CacheKey returns a string that identifies s in the cache.
+// Benchmarks ran with different settings have different keys.
+// Returns "" for default settings, so old caches remain valid.
+func (s *Settings) CacheKey() string {
+	if s.IsDefault() {
+		return ""
+	}
+	h := sha1.New()
+	for _, f := range s.TestFlags {
+		fmt.Fprintf(h, "flag %s\x00", f)
+	}
+	for _, e := range s.Env {
+		fmt.Fprintf(h, "env %s\x00", e)
+	}
+	if s.HasToolchain() {
+		if s.GoVersion == "" {
+			panic("toolchain is not resolved")
+		}
+		fmt.Fprintf(h, "toolchain %s\x00", s.GoVersion)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))[:16]
+}
+
+// String returns a human-readable representation of s.
+func (s *Settings) String() string {
+	return strings.Join(append(clip(s.Env), s.TestFlags...), " ")
+}
+
+// clip returns list with capacity limited to its length,
+// so that appending to the result does not modify list's backing array.
+func clip(list []string) []string {
+	return list[:len(list):len(list)]
+}
+
+// containsString returns true if list contains elem.
+func containsString(list []string, elem string) bool {
+	for _, a := range list {
+		if a == elem {
+			return true
+		}
+	}
+	return false
+}
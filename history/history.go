@@ -0,0 +1,180 @@
+// Package history lists commits of a git repository
+// and relates their benchmark results.
+package history
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nodirt/ggt/bench"
+	"github.com/nodirt/ggt/repo"
+)
+
+// Commit is a commit listed by git log.
+type Commit struct {
+	Id      string
+	Parents []string // with path limiting, parents are rewritten to listed commits
+
+	AuthorName     string
+	AuthorEmail    string
+	AuthorDate     string // in git's default date format
+	CommitterName  string
+	CommitterEmail string
+	CommitDate     string // in git's default date format
+	Subject        string
+	Message        string // raw commit message, including the subject
+}
+
+// commitFormat is a git log format of Commit fields, separated by \x1f.
+var commitFormat = strings.Join([]string{"%H", "%P", "%an", "%ae", "%ad", "%cn", "%ce", "%cd", "%s", "%B"}, "%x1f")
+
+// parseCommit parses a record printed by git log in commitFormat.
+func parseCommit(record string) (*Commit, error) {
+	fields := strings.Split(strings.Trim(record, "\x00\n"), "\x1f")
+	if len(fields) != 10 {
+		return nil, fmt.Errorf("unexpected git log output: %q", record)
+	}
+	return &Commit{
+		Id:             fields[0],
+		Parents:        strings.Fields(fields[1]),
+		AuthorName:     fields[2],
+		AuthorEmail:    fields[3],
+		AuthorDate:     fields[4],
+		CommitterName:  fields[5],
+		CommitterEmail: fields[6],
+		CommitDate:     fields[7],
+		Subject:        fields[8],
+		Message:        strings.TrimRight(fields[9], "\n"),
+	}, nil
+}
+
+// ShortId returns an abbreviated commit id.
+func (c *Commit) ShortId() string {
+	return ShortId(c.Id)
+}
+
+// History is a list of commits printed by git log.
+type History struct {
+	Commits []*Commit
+	byId    map[string]*Commit
+}
+
+// Read runs `git log` with args and returns the listed commits
+// with their metadata.
+// args must not contain --format.
+func Read(r *repo.Repo, args ...string) (*History, error) {
+	// with --parents, %P prints rewritten parents when history is path-limited.
+	// -z separates commits with NUL, because messages contain newlines.
+	gitLog := r.Git(append([]string{"log", "-z", "--parents", "--format=" + commitFormat}, args...)...)
+	gitLog.ReadOnly = true
+	h := &History{byId: map[string]*Commit{}}
+	err := repo.ForEachRecordOutput(gitLog, 0, func(record string) error {
+		if strings.Trim(record, "\x00\n") == "" {
+			return nil
+		}
+		c, err := parseCommit(record)
+		if err != nil {
+			return err
+		}
+		h.Commits = append(h.Commits, c)
+		h.byId[c.Id] = c
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("git log failed: %s", err)
+	}
+	return h, nil
+}
+
+// FirstParentChain returns ids of listed commits reachable from commitId,
+// commitId included, by following first parents.
+func (h *History) FirstParentChain(commitId string) []string {
+	var chain []string
+	for c := h.byId[commitId]; c != nil; {
+		chain = append(chain, c.Id)
+		if len(c.Parents) == 0 {
+			break
+		}
+		c = h.byId[c.Parents[0]]
+	}
+	return chain
+}
+
+// FileStat is a line count of changes of a file, as in git diff --numstat.
+type FileStat struct {
+	Path    string
+	Added   int
+	Deleted int
+	Binary  bool // true if lines are not counted
+}
+
+// String returns e.g. "+12 -3" or "binary".
+func (s *FileStat) String() string {
+	if s.Binary {
+		return "binary"
+	}
+	return fmt.Sprintf("+%d -%d", s.Added, s.Deleted)
+}
+
+// DiffStat returns files changed between two commits, in git's order.
+// Renamed files are reported at their new paths.
+func DiffStat(r *repo.Repo, from, to string) ([]FileStat, error) {
+	gitDiff := r.Git("diff", "-z", "--numstat", "--no-renames", from, to)
+	gitDiff.ReadOnly = true
+	var stats []FileStat
+	err := repo.ForEachRecordOutput(gitDiff, 0, func(record string) error {
+		record = strings.TrimSuffix(record, "\x00")
+		if record == "" {
+			return nil
+		}
+		fields := strings.SplitN(record, "\t", 3)
+		if len(fields) != 3 {
+			return fmt.Errorf("unexpected git diff output: %q", record)
+		}
+		s := FileStat{Path: fields[2], Binary: fields[0] == "-"}
+		if !s.Binary {
+			var err error
+			if s.Added, err = strconv.Atoi(fields[0]); err != nil {
+				return fmt.Errorf("unexpected git diff output: %q", record)
+			}
+			if s.Deleted, err = strconv.Atoi(fields[1]); err != nil {
+				return fmt.Errorf("unexpected git diff output: %q", record)
+			}
+		}
+		stats = append(stats, s)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("git diff failed: %s", err)
+	}
+	return stats, nil
+}
+
+// ShortId returns an abbreviated commit id.
+func ShortId(commitId string) string {
+	if len(commitId) > 7 {
+		return commitId[:7]
+	}
+	return commitId
+}
+
+// NearestAncestorBaseline returns a baseline that compares a benchmark with
+// the nearest ancestor where the benchmark's package did not fail.
+// ancestors are results of ancestorIds, parent first.
+// A benchmark compared with a commit other than the parent is labeled with the commit id.
+func NearestAncestorBaseline(ancestorIds []string, ancestors []*bench.Results) bench.BaselineFunc {
+	return func(series int, relPackagePath, name string) (*bench.Run, string) {
+		for i, a := range ancestors {
+			if a.Failures[series][relPackagePath] != nil {
+				continue
+			}
+			prev := a.Benchmarks[series][relPackagePath].Find(name)
+			if prev == nil || i == 0 {
+				return prev, ""
+			}
+			return prev, "vs " + ShortId(ancestorIds[i])
+		}
+		return nil, ""
+	}
+}
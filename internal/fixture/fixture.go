@@ -0,0 +1,451 @@
+// Package fixture creates throwaway git repositories with Go packages for tests.
+//
+// Benchmarks in fixture repos are not real: `go test` is replaced with a fake
+// go command that prints canned output committed to the package dir,
+// so results are deterministic and tests do not compile anything.
+// Other go commands, such as `go list`, are passed to the real go.
+package fixture
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+const (
+	// ImportPath is the import path of the root package of fixture repos.
+	ImportPath = "example.com/foo"
+
+	// BenchFile is a file in a package dir with the output of the fake `go test`.
+	// Benchmark result lines are printed only if they match -bench.
+	// A line "stderr: text" prints text to stderr.
+	// A line "exit N" stops the fake `go test` with exit code N.
+	BenchFile = "fakebench.txt"
+
+	// ProfileFile is a file in a package dir with CPU profile samples that
+	// the fake `go test` writes to -cpuprofile. Each line is a stack and a
+	// number of samples, e.g. "p.Run@p.go;p.sum@sum.go 20". Frames are
+	// function@file, callers first; files are relative to the package dir.
+	// Without ProfileFile, placeholder profiles are written.
+	ProfileFile = "fakeprofile.txt"
+)
+
+// Environment variables of the fake go command.
+const (
+	fakeGoEnv = "GGT_FIXTURE_FAKE_GO"     // "1" if the test binary runs as go
+	realGoEnv = "GGT_FIXTURE_REAL_GO"     // path to the real go
+	goLogEnv  = "GGT_FIXTURE_GO_TEST_LOG" // file that receives args of `go test` runs
+)
+
+// Main runs tests, or the fake go command if the test binary was started
+// as one. Packages that use New must call it from TestMain.
+func Main(m *testing.M) {
+	if os.Getenv(fakeGoEnv) == "1" {
+		os.Exit(fakeGo(os.Args[1:]))
+	}
+	os.Exit(m.Run())
+}
+
+// Repo is a git repository of ImportPath in a temporary $GOPATH.
+type Repo struct {
+	t      testing.TB
+	GoPath string
+	Dir    string // root of the repo
+	goLog  string
+}
+
+// New creates an empty repo and sets $GOPATH and $PATH so that
+// packages of the repo are found by go and `go test` is fake.
+// The environment is restored when the test finishes.
+func New(t testing.TB) *Repo {
+	t.Helper()
+	realGo, err := exec.LookPath("go")
+	if err != nil {
+		t.Fatalf("go not found: %s", err)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmp := t.TempDir()
+	r := &Repo{
+		t:      t,
+		GoPath: filepath.Join(tmp, "gopath"),
+		goLog:  filepath.Join(tmp, "go-test.log"),
+	}
+	r.Dir = filepath.Join(r.GoPath, "src", ImportPath)
+	bin := filepath.Join(tmp, "bin")
+	for _, dir := range []string{r.Dir, bin} {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(exe, filepath.Join(bin, "go")); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PATH", bin+string(filepath.ListSeparator)+os.Getenv("PATH"))
+	t.Setenv("GOPATH", r.GoPath)
+	t.Setenv("GO111MODULE", "off")
+	t.Setenv("GOFLAGS", "")
+	t.Setenv(fakeGoEnv, "1")
+	t.Setenv(realGoEnv, realGo)
+	t.Setenv(goLogEnv, r.goLog)
+
+	r.Git("init", "-q", ".")
+	r.Git("config", "user.name", "Fixture")
+	r.Git("config", "user.email", "fixture@example.com")
+	r.Git("config", "commit.gpgsign", "false")
+	return r
+}
+
+// Git runs git in the repo and returns its trimmed output.
+// Fails the test if git fails.
+func (r *Repo) Git(args ...string) string {
+	r.t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", r.Dir}, args...)...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		r.t.Fatalf("git %s: %s\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// WriteFile writes a file at a path relative to the repo root.
+func (r *Repo) WriteFile(name, content string) {
+	r.t.Helper()
+	filename := filepath.Join(r.Dir, name)
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		r.t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+		r.t.Fatal(err)
+	}
+}
+
+// Package writes a Go package at relPackagePath whose fake `go test`
+// prints output, see BenchFile.
+func (r *Repo) Package(relPackagePath string, output ...string) {
+	r.t.Helper()
+	r.WriteFile(filepath.Join(relPackagePath, "p.go"), "package p\n")
+	r.WriteFile(filepath.Join(relPackagePath, BenchFile), strings.Join(output, "\n")+"\n")
+}
+
+// Commit commits all changes and returns the commit id.
+func (r *Repo) Commit(message string) string {
+	r.t.Helper()
+	r.Git("add", "-A")
+	r.Git("commit", "-q", "--allow-empty", "-m", message)
+	return r.Git("rev-parse", "HEAD")
+}
+
+// GoTestRuns returns arguments of the fake `go test` runs so far,
+// each joined with spaces. Runs of fake test binaries start with
+// "test-binary", see fakeGo.
+func (r *Repo) GoTestRuns() []string {
+	r.t.Helper()
+	data, err := ioutil.ReadFile(r.goLog)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+// fakeGo runs go with args and returns the exit code.
+// `go test` prints the BenchFile of the package found in $GOPATH,
+// and writes profiles if it does not fail, see ProfileFile.
+// `go test -c -o bin` writes a fake test binary, a script that runs
+// fakeGo with "test-binary" and its args, which prints the BenchFile
+// in the current dir. Runs of both are recorded, see GoTestRuns.
+func fakeGo(args []string) int {
+	if len(args) == 0 || (args[0] != "test" && args[0] != "test-binary") {
+		cmd := exec.Command(os.Getenv(realGoEnv), args...)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			if exit, ok := err.(*exec.ExitError); ok {
+				return exit.ExitCode()
+			}
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	if err := appendLine(os.Getenv(goLogEnv), strings.Join(args, " ")); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	var benchFilter *benchMatcher
+	var profiles []string
+	cpuProfile := ""
+	compile := false
+	output := ""
+	for i, a := range args[1:] {
+		a = strings.Replace(a, "-test.", "-", 1)
+		switch {
+		case a == "-c":
+			compile = true
+		case a == "-o" && i+2 < len(args):
+			output = args[i+2]
+		case strings.HasPrefix(a, "-cpuprofile="):
+			cpuProfile = strings.TrimPrefix(a, "-cpuprofile=")
+		case strings.HasPrefix(a, "-memprofile="), strings.HasPrefix(a, "-trace="):
+			profiles = append(profiles, a[strings.Index(a, "=")+1:])
+		case strings.HasPrefix(a, "-bench="):
+			var err error
+			if benchFilter, err = newBenchMatcher(strings.TrimPrefix(a, "-bench=")); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+		}
+	}
+
+	var dir, importPath string
+	if args[0] == "test-binary" {
+		var err error
+		if dir, err = os.Getwd(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	} else {
+		importPath = args[len(args)-1]
+		for _, p := range filepath.SplitList(os.Getenv("GOPATH")) {
+			if _, err := os.Stat(filepath.Join(p, "src", importPath)); err == nil {
+				dir = filepath.Join(p, "src", importPath)
+				break
+			}
+		}
+		if dir == "" {
+			fmt.Fprintf(os.Stderr, "cannot find package %q\n", importPath)
+			return 1
+		}
+	}
+
+	if compile {
+		exe, err := os.Executable()
+		if err == nil {
+			script := fmt.Sprintf("#!/bin/sh\nexec '%s' test-binary \"$@\"\n", exe)
+			err = ioutil.WriteFile(output, []byte(script), 0755)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	f, err := os.Open(filepath.Join(dir, BenchFile))
+	if os.IsNotExist(err) {
+		fmt.Println("PASS")
+		if importPath != "" {
+			fmt.Printf("ok  \t%s\t0.001s\n", importPath)
+		}
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		switch {
+		case strings.HasPrefix(line, "stderr: "):
+			fmt.Fprintln(os.Stderr, strings.TrimPrefix(line, "stderr: "))
+		case len(fields) == 2 && fields[0] == "exit":
+			code, err := strconv.Atoi(fields[1])
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			return code
+		case len(fields) > 0 && strings.HasPrefix(fields[0], "Benchmark"):
+			if benchFilter.match(strings.SplitN(fields[0], "-", 2)[0]) {
+				fmt.Println(line)
+			}
+		default:
+			fmt.Println(line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if cpuProfile != "" {
+		if _, err := os.Stat(filepath.Join(dir, ProfileFile)); err != nil {
+			profiles = append(profiles, cpuProfile)
+		} else if err := writeProfile(dir, cpuProfile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	for _, p := range profiles {
+		if err := ioutil.WriteFile(p, []byte("fake profile\n"), 0644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// benchMatcher matches benchmark names against a -bench value the way
+// the testing package does: the value is split into alternatives by '|'
+// and into per-level patterns by '/', both outside of parentheses and
+// brackets, and each pattern must match the corresponding level of a name.
+// Names with fewer levels than patterns are parents, which report no results.
+type benchMatcher struct {
+	alternatives [][]*regexp.Regexp
+}
+
+// newBenchMatcher parses a -bench value.
+func newBenchMatcher(value string) (*benchMatcher, error) {
+	m := &benchMatcher{}
+	for _, alt := range splitBenchRegex(value, '|') {
+		var levels []*regexp.Regexp
+		for _, pattern := range splitBenchRegex(alt, '/') {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, err
+			}
+			levels = append(levels, re)
+		}
+		m.alternatives = append(m.alternatives, levels)
+	}
+	return m, nil
+}
+
+// match returns true if name matches. A nil m matches nothing, like no -bench.
+func (m *benchMatcher) match(name string) bool {
+	if m == nil {
+		return false
+	}
+	levels := strings.Split(name, "/")
+	for _, patterns := range m.alternatives {
+		matched := len(levels) >= len(patterns)
+		for i := 0; matched && i < len(patterns); i++ {
+			matched = patterns[i].MatchString(levels[i])
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// splitBenchRegex splits s by sep outside of parentheses and brackets.
+func splitBenchRegex(s string, sep byte) []string {
+	var parts []string
+	brackets, parens := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '[':
+			brackets++
+		case ']':
+			if brackets > 0 {
+				brackets--
+			}
+		case '(':
+			if brackets == 0 {
+				parens++
+			}
+		case ')':
+			if brackets == 0 {
+				parens--
+			}
+		case '\\':
+			i++
+		case sep:
+			if brackets == 0 && parens == 0 {
+				parts = append(parts, s[:i])
+				s = s[i+1:]
+				i = -1
+			}
+		}
+	}
+	return append(parts, s)
+}
+
+// writeProfile writes a CPU profile of the samples in ProfileFile in dir to filename.
+func writeProfile(dir, filename string) error {
+	data, err := ioutil.ReadFile(filepath.Join(dir, ProfileFile))
+	if err != nil {
+		return err
+	}
+	const period = 10000000 // 10ms, like Go's CPU profiles
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+		PeriodType: &profile.ValueType{Type: "cpu", Unit: "nanoseconds"},
+		Period:     period,
+	}
+	locations := map[string]*profile.Location{}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return fmt.Errorf("invalid %s line %q", ProfileFile, line)
+		}
+		n, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid %s line %q", ProfileFile, line)
+		}
+		frames := strings.Split(fields[0], ";")
+		sample := &profile.Sample{Value: []int64{n, n * period}}
+		// Locations of a sample are leaf first.
+		for i := len(frames) - 1; i >= 0; i-- {
+			loc := locations[frames[i]]
+			if loc == nil {
+				parts := strings.SplitN(frames[i], "@", 2)
+				if len(parts) != 2 {
+					return fmt.Errorf("invalid frame %q in %s", frames[i], ProfileFile)
+				}
+				id := uint64(len(locations) + 1)
+				f := &profile.Function{ID: id, Name: parts[0], Filename: filepath.Join(dir, parts[1])}
+				loc = &profile.Location{ID: id, Line: []profile.Line{{Function: f, Line: 1}}}
+				locations[frames[i]] = loc
+				p.Function = append(p.Function, f)
+				p.Location = append(p.Location, loc)
+			}
+			sample.Location = append(sample.Location, loc)
+		}
+		p.Sample = append(p.Sample, sample)
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := p.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// appendLine appends a line to a file.
+func appendLine(filename, line string) error {
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
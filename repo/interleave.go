@@ -0,0 +1,164 @@
+package repo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nodirt/ggt/bench"
+)
+
+// Interleave reduces drift between benchmark results of two revisions,
+// e.g. caused by thermal throttling or background load.
+// It builds test binaries of both revisions and runs them in alternation
+// rounds times, old first. Samples of benchmarks present in both old and
+// new results are recorded in the results and in the cache of both
+// revisions, keyed by the tree of the other revision, see bench.Run.Interleaved.
+// Packages that failed in either revision are skipped.
+// Pairs interleaved before are not interleaved again, unless caching is off.
+//
+// Returns copies of oldResults and newResults to compare, in which ns/op of
+// interleaved benchmarks is the median of their samples from this pair.
+// ns/op in oldResults, newResults and the cache is not changed.
+func (s *PackageSet) Interleave(oldRevision, newRevision string, series []bench.Series, rounds int, oldResults, newResults *bench.Results) (oldView, newView *bench.Results, err error) {
+	if rounds <= 0 {
+		return oldResults, newResults, nil
+	}
+	oldBox, err := NewSandbox(s, oldRevision)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer oldBox.Close()
+	newBox, err := NewSandbox(s, newRevision)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer newBox.Close()
+	if oldBox.TreeId == newBox.TreeId {
+		return oldResults, newResults, nil
+	}
+
+	binDir, err := tempDir("bin-")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.RemoveAll(binDir)
+
+	for i, ser := range series {
+		oldSnapshot := oldBox.WithSettings(ser.Settings)
+		newSnapshot := newBox.WithSettings(ser.Settings)
+		for j, pkg := range s.RelPackagePaths {
+			if oldResults.Failures[i][pkg] != nil || newResults.Failures[i][pkg] != nil {
+				continue
+			}
+			oldRuns, newRuns := oldResults.Benchmarks[i][pkg], newResults.Benchmarks[i][pkg]
+			var names []string
+			for _, b := range newRuns {
+				if oldRuns.Find(b.Name) != nil {
+					names = append(names, b.Name)
+				}
+			}
+			if len(names) == 0 {
+				continue
+			}
+
+			sides := []*interleavedSide{
+				{pkg: &oldSnapshot.Packages[j], runs: oldRuns},
+				{pkg: &newSnapshot.Packages[j], runs: newRuns},
+			}
+			sides[0].otherTreeId, sides[1].otherTreeId = newBox.TreeId, oldBox.TreeId
+			if err := interleavePackage(sides, names, rounds, filepath.Join(binDir, fmt.Sprint(i))); err != nil {
+				return nil, nil, fmt.Errorf("could not interleave %s at %s and %s: %s", pkg, oldRevision, newRevision, err)
+			}
+		}
+	}
+	return interleavedView(oldResults, newBox.TreeId), interleavedView(newResults, oldBox.TreeId), nil
+}
+
+// interleavedView returns a copy of results in which ns/op of benchmarks
+// interleaved with the tree otherTreeId is the median of their samples.
+func interleavedView(results *bench.Results, otherTreeId string) *bench.Results {
+	view := bench.NewResults(len(results.Benchmarks))
+	for i, packages := range results.Benchmarks {
+		view.Failures[i] = results.Failures[i]
+		for pkg, runs := range packages {
+			copied := make(bench.RunSlice, len(runs))
+			for j := range runs {
+				if b := runs[j].InterleavedWith(otherTreeId); b != nil {
+					copied[j] = *b
+				} else {
+					copied[j] = runs[j]
+				}
+			}
+			view.Benchmarks[i][pkg] = copied
+		}
+	}
+	return view
+}
+
+// interleavedSide is a package snapshot, one of two being interleaved.
+type interleavedSide struct {
+	pkg         *PackageSnapshot
+	runs        bench.RunSlice // results to add samples to
+	otherTreeId string         // tree id of the other side
+	bin         string         // test binary
+	samples     map[string][]*bench.Run
+}
+
+// interleavePackage runs benchmarks names of two package snapshots in
+// alternation and records the samples in the runs and caches of both sides.
+// Test binaries are stored in binDir.
+func interleavePackage(sides []*interleavedSide, names []string, rounds int, binDir string) error {
+	interleaved := true
+	for _, side := range sides {
+		side.pkg.EnsureCacheLoaded()
+		for _, name := range names {
+			b := side.runs.Find(name)
+			interleaved = interleaved && b != nil && b.Interleaved[side.otherTreeId] != nil
+		}
+	}
+	if interleaved && sides[0].pkg.Snapshot.Caching {
+		Verbose.Printf("%s was interleaved before\n", sides[0].pkg.RelPackagePath)
+		return nil
+	}
+
+	if err := os.MkdirAll(binDir, os.ModePerm); err != nil {
+		return err
+	}
+	for i, side := range sides {
+		side.bin = filepath.Join(binDir, fmt.Sprintf("%d.test", i))
+		if err := side.pkg.buildTestBinary(side.bin); err != nil {
+			return err
+		}
+		side.samples = map[string][]*bench.Run{}
+	}
+
+	benchRegexes := exactBenchRegexes(names)
+	for r := 0; r < rounds; r++ {
+		Verbose.Printf("interleaving %s, round %d of %d\n", sides[0].pkg.RelPackagePath, r+1, rounds)
+		for _, side := range sides {
+			for _, benchRegex := range benchRegexes {
+				runs, err := side.pkg.runTestBinary(side.bin, benchRegex)
+				if err != nil {
+					return err
+				}
+				for i := range runs {
+					side.samples[runs[i].Name] = append(side.samples[runs[i].Name], &runs[i])
+				}
+			}
+		}
+	}
+
+	for _, side := range sides {
+		for name, samples := range side.samples {
+			if b := side.runs.Find(name); b != nil {
+				b.SetInterleaved(side.otherTreeId, samples)
+			}
+			if b := side.pkg.Cache.Benchmarks.Find(name); b != nil {
+				b.SetInterleaved(side.otherTreeId, samples)
+			}
+		}
+		side.pkg.SaveCache()
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package repo
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nodirt/ggt/bench"
+	"github.com/nodirt/ggt/internal/fixture"
+)
+
+func TestInterleave(t *testing.T) {
+	r := fixture.New(t)
+	r.Package(".", "BenchmarkA 100 10 ns/op", "BenchmarkB/x 100 20 ns/op")
+	old := r.Commit("old")
+	r.Package(".", "BenchmarkA 100 15 ns/op", "BenchmarkB/x 100 25 ns/op")
+	new := r.Commit("new")
+	set := openFixture(t, fixture.ImportPath)
+	series := []bench.Series{{}}
+	runs := &goTestRunCounter{r: r}
+
+	oldResults, err := set.GetSeriesBenchmarks(old, ".", series)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newResults, err := set.GetSeriesBenchmarks(new, ".", series)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs.newRuns()
+	oldView, _, err := set.Interleave(old, new, series, 2, oldResults, newResults)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sub-benchmarks are run with a pattern per level.
+	var binaryRuns int
+	for _, run := range runs.newRuns() {
+		if !strings.HasPrefix(run, "test-binary ") {
+			continue
+		}
+		binaryRuns++
+		if !strings.Contains(run, "-test.bench=^(BenchmarkA)$") && !strings.Contains(run, "-test.bench=^BenchmarkB$/^x$") {
+			t.Errorf("unexpected test binary run %q", run)
+		}
+	}
+	if binaryRuns != 8 {
+		t.Errorf("test binaries ran %d times, want 2 sides * 2 rounds * 2 patterns", binaryRuns)
+	}
+	for _, results := range []*bench.Results{oldResults, newResults} {
+		for _, b := range results.Benchmarks[0]["."] {
+			for id, samples := range b.Interleaved {
+				if len(samples.NsPerOp) != 2 {
+					t.Errorf("%s has %d samples with %s, want 2", b.Name, len(samples.NsPerOp), id)
+				}
+			}
+			if len(b.Interleaved) != 1 {
+				t.Errorf("%s is interleaved with %d trees, want 1", b.Name, len(b.Interleaved))
+			}
+		}
+	}
+	if got := nsPerOp(oldView.Benchmarks[0]["."]); !reflect.DeepEqual(got, []string{"BenchmarkA=10", "BenchmarkB/x=20"}) {
+		t.Errorf("old view: %q", got)
+	}
+}
+
+func TestInterleaveKeepsPairsApart(t *testing.T) {
+	r := fixture.New(t)
+	r.Package(".", "BenchmarkA 100 10 ns/op")
+	first := r.Commit("first")
+	r.Package(".", "BenchmarkA 100 20 ns/op")
+	second := r.Commit("second")
+	r.Package(".", "BenchmarkA 100 30 ns/op")
+	third := r.Commit("third")
+	set := openFixture(t, fixture.ImportPath)
+	series := []bench.Series{{}}
+	get := func(revision string) *bench.Results {
+		results, err := set.GetSeriesBenchmarks(revision, ".", series)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return results
+	}
+	interleave := func(old, new string, oldResults, newResults *bench.Results) (oldView, newView *bench.Results) {
+		oldView, newView, err := set.Interleave(old, new, series, 1, oldResults, newResults)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return oldView, newView
+	}
+
+	secondResults := get(second)
+	interleave(second, third, secondResults, get(third))
+	// Drift while interleaving with the third commit does not affect
+	// the comparison with the first one.
+	thirdTree := r.Git("rev-parse", third+"^{tree}")
+	secondResults.Benchmarks[0]["."][0].Interleaved[thirdTree].NsPerOp[0] = 100
+	_, secondView := interleave(first, second, get(first), secondResults)
+	if got := nsPerOp(secondView.Benchmarks[0]["."]); !reflect.DeepEqual(got, []string{"BenchmarkA=20"}) {
+		t.Errorf("second view: %q", got)
+	}
+
+	// ns/op in the cache is not changed by interleaving, and pairs
+	// interleaved before are loaded from the cache.
+	runs := &goTestRunCounter{r: r}
+	runs.newRuns()
+	cached := get(second).Benchmarks[0]["."]
+	if got := nsPerOp(cached); !reflect.DeepEqual(got, []string{"BenchmarkA=20"}) {
+		t.Errorf("cached second: %q", got)
+	}
+	if len(cached[0].Interleaved) != 2 {
+		t.Errorf("second is interleaved with %d trees, want 2", len(cached[0].Interleaved))
+	}
+	_, thirdView := interleave(second, third, get(second), get(third))
+	if got := nsPerOp(thirdView.Benchmarks[0]["."]); !reflect.DeepEqual(got, []string{"BenchmarkA=30"}) {
+		t.Errorf("cached third view: %q", got)
+	}
+	if got := runs.newRuns(); len(got) != 0 {
+		t.Errorf("unexpected go test runs %q", got)
+	}
+}
@@ -0,0 +1,214 @@
+package repo
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrInterrupted is returned by commands stopped or not started
+// because of Interrupt.
+var ErrInterrupted = errors.New("interrupted")
+
+// killDelay is how long Interrupt waits for processes to exit
+// before killing them.
+const killDelay = 5 * time.Second
+
+// interruption is the state of Interrupt.
+var interruption struct {
+	sync.Mutex
+	interrupted bool
+	processes   map[*os.Process]bool // running processes
+	sandboxes   map[*Sandbox]bool    // open sandboxes
+}
+
+// Interrupt stops running processes and makes commands that have not started
+// fail with ErrInterrupted. Benchmark results received before the interruption
+// are cached, so running the same benchmarks again resumes from them.
+// Processes that do not exit on interrupt are killed after killDelay.
+// Sandboxes are not closed; they are closed as the callers return errors.
+func Interrupt() {
+	interruption.Lock()
+	defer interruption.Unlock()
+	if interruption.interrupted {
+		return
+	}
+	interruption.interrupted = true
+	var interrupted []*os.Process
+	for p := range interruption.processes {
+		interruptProcess(p)
+		interrupted = append(interrupted, p)
+	}
+	time.AfterFunc(killDelay, func() {
+		interruption.Lock()
+		defer interruption.Unlock()
+		for _, p := range interrupted {
+			if interruption.processes[p] {
+				killProcess(p)
+			}
+		}
+	})
+}
+
+// Kill kills running processes.
+func Kill() {
+	interruption.Lock()
+	defer interruption.Unlock()
+	for p := range interruption.processes {
+		killProcess(p)
+	}
+}
+
+// Interrupted returns true if Interrupt was called.
+func Interrupted() bool {
+	interruption.Lock()
+	defer interruption.Unlock()
+	return interruption.interrupted
+}
+
+// trackProcess registers a started process, so Interrupt stops it.
+// Call the returned function after the process exits.
+func trackProcess(p *os.Process) (untrack func()) {
+	interruption.Lock()
+	defer interruption.Unlock()
+	if interruption.processes == nil {
+		interruption.processes = map[*os.Process]bool{}
+	}
+	interruption.processes[p] = true
+	if interruption.interrupted {
+		// Interrupted while starting.
+		interruptProcess(p)
+	}
+	return func() {
+		interruption.Lock()
+		defer interruption.Unlock()
+		delete(interruption.processes, p)
+	}
+}
+
+// trackSandbox registers an open sandbox, so CloseSandboxes closes it.
+func trackSandbox(s *Sandbox, open bool) {
+	interruption.Lock()
+	defer interruption.Unlock()
+	if interruption.sandboxes == nil {
+		interruption.sandboxes = map[*Sandbox]bool{}
+	}
+	if open {
+		interruption.sandboxes[s] = true
+	} else {
+		delete(interruption.sandboxes, s)
+	}
+}
+
+// CloseSandboxes closes all open sandboxes, deleting their checkouts.
+// Use it when exiting without returning from the functions that opened them.
+func CloseSandboxes() {
+	interruption.Lock()
+	var sandboxes []*Sandbox
+	for s := range interruption.sandboxes {
+		sandboxes = append(sandboxes, s)
+	}
+	interruption.Unlock()
+	for _, s := range sandboxes {
+		s.Close()
+	}
+}
+
+// tempDirPrefix is the name prefix of temp dirs created by ggt.
+const tempDirPrefix = "ggt-"
+
+// ownerFile is the name of a file in a temp dir with the pid of the
+// process that created the dir.
+const ownerFile = "ggt.pid"
+
+// tempDirRegex matches names of temp dirs created by tempDir:
+// tempDirPrefix, an optional prefix and the random suffix of ioutil.TempDir.
+var tempDirRegex = regexp.MustCompile(`^` + tempDirPrefix + `([a-z]+-)?[0-9]+$`)
+
+// tempDir creates a temp dir with a name that starts with tempDirPrefix
+// and records the current process as the owner, see OrphanedTempDirs.
+func tempDir(prefix string) (string, error) {
+	dir, err := ioutil.TempDir("", tempDirPrefix+prefix)
+	if err != nil {
+		return "", err
+	}
+	pid := []byte(strconv.Itoa(os.Getpid()))
+	if err := ioutil.WriteFile(filepath.Join(dir, ownerFile), pid, 0644); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// OrphanedTempDirs returns temp dirs created by ggt processes that are not
+// running anymore, e.g. checkouts of sandboxes that were not closed
+// because ggt was killed. Dirs without an owner that were last modified
+// before unownedBefore are orphaned too if they look like ggt temp dirs,
+// see isGgtTempDir; they were created by older versions of ggt or by
+// a process killed while creating the dir.
+func OrphanedTempDirs(unownedBefore time.Time) ([]string, error) {
+	infos, err := ioutil.ReadDir(os.TempDir())
+	if err != nil {
+		return nil, err
+	}
+	var orphaned []string
+	for _, info := range infos {
+		if !info.IsDir() || !strings.HasPrefix(info.Name(), tempDirPrefix) {
+			continue
+		}
+		dir := filepath.Join(os.TempDir(), info.Name())
+		pidBytes, err := ioutil.ReadFile(filepath.Join(dir, ownerFile))
+		if err != nil && !os.IsNotExist(err) {
+			// E.g. a dir of another user.
+			continue
+		}
+		hasOwnerFile := err == nil
+		pid, err := strconv.Atoi(strings.TrimSpace(string(pidBytes)))
+		if err != nil {
+			if info.ModTime().Before(unownedBefore) && isGgtTempDir(dir, hasOwnerFile) {
+				orphaned = append(orphaned, dir)
+			}
+		} else if !processExists(pid) {
+			orphaned = append(orphaned, dir)
+		}
+	}
+	return orphaned, nil
+}
+
+// isGgtTempDir returns true if dir, which has no valid owner, has the layout
+// of a dir created by tempDir: a name that matches tempDirRegex, and an owner
+// file or a sandbox checkout in src/. Other dirs whose names start with
+// tempDirPrefix may belong to the user or other tools, so they are not deleted.
+func isGgtTempDir(dir string, hasOwnerFile bool) bool {
+	if !tempDirRegex.MatchString(filepath.Base(dir)) {
+		return false
+	}
+	if hasOwnerFile {
+		return true
+	}
+	info, err := os.Stat(filepath.Join(dir, "src"))
+	return err == nil && info.IsDir()
+}
+
+// processExists returns true if a process with pid is running.
+func processExists(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		// On Windows, FindProcess fails if there is no such process.
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	// Signal 0 checks that the process exists without sending a signal.
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,143 @@
+package repo
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nodirt/ggt/internal/fixture"
+)
+
+// interruptAfterTest resets the state of Interrupt when the test finishes.
+func interruptAfterTest(t *testing.T) {
+	t.Cleanup(func() {
+		interruption.Lock()
+		defer interruption.Unlock()
+		interruption.interrupted = false
+	})
+}
+
+func TestExecRunnerInterrupt(t *testing.T) {
+	interruptAfterTest(t)
+	done := make(chan error)
+	go func() {
+		done <- ExecRunner{}.Run(&Command{Path: "sh", Args: []string{"-c", "exec sleep 10"}})
+	}()
+	for {
+		interruption.Lock()
+		started := len(interruption.processes) > 0
+		interruption.Unlock()
+		if started {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	Interrupt()
+	select {
+	case err := <-done:
+		if err != ErrInterrupted {
+			t.Errorf("got error %v, want ErrInterrupted", err)
+		}
+	case <-time.After(killDelay / 2):
+		t.Fatal("the process was not interrupted")
+	}
+
+	// New commands do not start.
+	if err := (ExecRunner{}).Run(&Command{Path: "true"}); err != ErrInterrupted {
+		t.Errorf("got error %v, want ErrInterrupted", err)
+	}
+}
+
+func TestInterruptedRunIsResumed(t *testing.T) {
+	r := fixture.New(t)
+	r.Package(".", "BenchmarkA 100 10 ns/op", "BenchmarkB 100 20 ns/op")
+	r.Commit("first")
+	set := openFixture(t, fixture.ImportPath)
+
+	// The run is interrupted after BenchmarkA.
+	prev := CommandRunner
+	useRunner(t, &fakeRunner{chunks: []string{"BenchmarkA 100 10 ns/op\n"}, err: ErrInterrupted})
+	s := NewSnapshot(set, "fake")
+	if _, err := s.Packages[0].GetBenchmarks(".", nil); err != ErrInterrupted {
+		t.Fatalf("got error %v, want ErrInterrupted", err)
+	}
+
+	// The next run resumes from BenchmarkB.
+	CommandRunner = prev
+	s = NewSnapshot(set, "fake")
+	benchmarks, err := s.Packages[0].GetBenchmarks(".", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := nsPerOp(benchmarks), []string{"BenchmarkA=10", "BenchmarkB=20"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	runs := r.GoTestRuns()
+	if len(runs) != 2 || !strings.Contains(runs[0], "-benchtime=1x") || !strings.Contains(runs[1], "-bench=^(BenchmarkB)$") {
+		t.Errorf("unexpected go test runs %q", runs)
+	}
+}
+
+func TestOrphanedTempDirs(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	// A process that exited.
+	exited := exec.Command("true")
+	if err := exited.Run(); err != nil {
+		t.Fatal(err)
+	}
+	// owner "-" is an empty owner file, "src" is a checkout without an owner file.
+	dir := func(name, owner string, modTime time.Time) {
+		t.Helper()
+		path := filepath.Join(tmp, name)
+		if err := os.Mkdir(path, 0755); err != nil {
+			t.Fatal(err)
+		}
+		switch owner {
+		case "":
+		case "-":
+			owner = ""
+			fallthrough
+		default:
+			if err := ioutil.WriteFile(filepath.Join(path, ownerFile), []byte(owner), 0644); err != nil {
+				t.Fatal(err)
+			}
+		case "src":
+			if err := os.Mkdir(filepath.Join(path, "src"), 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+	dir("ggt-running", strconv.Itoa(os.Getpid()), old)
+	dir("ggt-exited", strconv.Itoa(exited.Process.Pid), now)
+	dir("ggt-123", "src", old)   // a sandbox of an old ggt
+	dir("ggt-bin-456", "-", old) // killed before writing the pid
+	dir("ggt-789", "src", now)   // may be being created
+	dir("ggt-notes", "src", old) // not named by ggt
+	dir("ggt-1000", "", old)     // not a ggt layout
+	dir("other", "", old)
+
+	got, err := OrphanedTempDirs(now.Add(-24 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+	want := []string{filepath.Join(tmp, "ggt-123"), filepath.Join(tmp, "ggt-bin-456"), filepath.Join(tmp, "ggt-exited")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
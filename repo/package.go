@@ -0,0 +1,232 @@
+package repo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/nodirt/ggt/bench"
+)
+
+// PackageSet is a collection of Go packages within one git repository.
+type PackageSet struct {
+	Repo
+	RootPackageImportPath string   // import path of the root package in the repo
+	RelPackagePaths       []string // list of dirs relative to the root package
+	packagesStrings       []string // packages specified on the command line, possibly patterns.
+
+	Settings bench.Settings // applied to every `go test` run
+	Caching  bool           // true to load results from the cache. Results are saved regardless.
+	PinCPUs  []int          // CPUs to pin `go test` to. Empty to not pin.
+	Limits   bench.Limits   // limits of `go test` and test binary runs
+
+	// Progress, if not nil, is called before `go test` or a test binary runs
+	// in a package, with nil benchmark, and after each benchmark result.
+	Progress func(pkg *PackageSnapshot, benchmark *bench.Run)
+}
+
+// goListEntry is one of packages returned by `go list`.
+type goListEntry struct {
+	dir        string
+	importPath string
+}
+
+// resolvePackages returns importPath and location for each package.
+// packages parameter may contain patterns.
+func resolvePackages(packages []string) ([]goListEntry, error) {
+	args := append([]string{"list", "-f", "{{.Dir}}:{{.ImportPath}}"}, packages...)
+	out, err := Output(&Command{Path: "go", Args: args, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve packages %s: %s", packages, err)
+	}
+	var result []goListEntry
+	for _, line := range strings.Split(out, "\n") {
+		if line == "" {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			log.Panicf("unexpected go list output: %s", line)
+		}
+		result = append(result, goListEntry{parts[0], parts[1]})
+	}
+	return result, nil
+}
+
+// Open resolves packages, which may contain patterns, and returns
+// a package set with caching enabled.
+// All packages must be in one git repository. Packages may be in
+// subdirectories of the repo root; RelPackagePaths are then like "bar/baz",
+// without a "./" prefix.
+func Open(packages []string) (*PackageSet, error) {
+	entries, err := resolvePackages(packages)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("packages not found")
+	}
+	for _, e := range entries {
+		if e.importPath == "_"+e.dir {
+			return nil, fmt.Errorf("package %s is not under a $GOPATH or $GOROOT", e.dir)
+		}
+	}
+	Verbose.Printf("resolved packages: %s\n", entries)
+
+	set := PackageSet{
+		packagesStrings: packages[:],
+		RelPackagePaths: make([]string, len(entries)),
+		Caching:         true,
+	}
+	for i, e := range entries {
+		revParse := Git(e.dir, "rev-parse", "--git-dir")
+		revParse.ReadOnly = true
+		gitDir, err := Output(revParse)
+		if err != nil {
+			return nil, fmt.Errorf("package %s is not in a git repository: %s", e.dir, err)
+		}
+		// git prints an absolute path unless e.dir is the repo root,
+		// so joining it with e.dir would produce a wrong path.
+		if !filepath.IsAbs(gitDir) {
+			gitDir = filepath.Join(e.dir, gitDir)
+		}
+		repoRoot := filepath.Dir(gitDir)
+		set.RelPackagePaths[i], err = filepath.Rel(repoRoot, e.dir)
+		if err != nil {
+			return nil, err
+		}
+		if set.Root == "" {
+			set.Root = repoRoot
+			set.GitDir = filepath.Base(gitDir)
+			set.RootPackageImportPath = e.importPath
+			relPath := set.RelPackagePaths[i]
+			for relPath != "." {
+				set.RootPackageImportPath = filepath.Dir(set.RootPackageImportPath)
+				relPath = filepath.Dir(relPath)
+			}
+		} else if set.Root != repoRoot {
+			return nil, fmt.Errorf("packages span multiple git repositories")
+		}
+	}
+	return &set, nil
+}
+
+// packageFilePatterns match files in a package dir that may affect benchmarks.
+var packageFilePatterns = []string{"*.go", "*.s", "*.c", "*.h", "*.syso", "testdata/**"}
+
+// listedPackage is a package printed by `go list -json`.
+type listedPackage struct {
+	Dir    string
+	Module *struct {
+		GoMod string
+	}
+	EmbedFiles, TestEmbedFiles, XTestEmbedFiles []string
+}
+
+// DependencyPathspecs returns git pathspecs that match files of the packages in s,
+// their dependencies within the repo, including test dependencies, files they
+// embed, go.mod/go.sum of their modules and go.work/go.work.sum in the root.
+// Dependencies are resolved in the current working tree with the toolchain
+// and environment of s.Settings.
+func (s *PackageSet) DependencyPathspecs() ([]string, error) {
+	args := append([]string{"list", "-deps", "-test", "-json"}, s.packagesStrings...)
+	out, err := Output(&Command{
+		Path:     s.Settings.GoCommand(),
+		Args:     args,
+		Env:      append(s.Settings.GoEnv(), s.Settings.Env...),
+		ReadOnly: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot list dependencies of %s: %s", s.packagesStrings, err)
+	}
+
+	pathspecs := []string{":(top)go.mod", ":(top)go.sum", ":(top)go.work", ":(top)go.work.sum"}
+	add := func(pathspec string) {
+		if !containsString(pathspecs, pathspec) {
+			pathspecs = append(pathspecs, pathspec)
+		}
+	}
+	// relative returns path relative to the repo root, or "" if it is outside.
+	relative := func(abs string) string {
+		rel, err := filepath.Rel(s.Root, abs)
+		if abs == "" || err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+			return ""
+		}
+		return filepath.ToSlash(rel)
+	}
+	dec := json.NewDecoder(strings.NewReader(out))
+	for {
+		var p listedPackage
+		if err := dec.Decode(&p); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("cannot parse go list output: %s", err)
+		}
+		rel := relative(p.Dir)
+		if rel == "" {
+			// not in the repo
+			continue
+		}
+		// match source files in the package dir, but not in subpackages.
+		for _, pattern := range packageFilePatterns {
+			add(":(top,glob)" + path.Join(rel, pattern))
+		}
+		for _, files := range [][]string{p.EmbedFiles, p.TestEmbedFiles, p.XTestEmbedFiles} {
+			for _, f := range files {
+				add(":(top,literal)" + path.Join(rel, f))
+			}
+		}
+		if p.Module != nil {
+			if goMod := relative(p.Module.GoMod); goMod != "" {
+				add(":(top,literal)" + goMod)
+				add(":(top,literal)" + path.Join(path.Dir(goMod), "go.sum"))
+			}
+		}
+	}
+	Verbose.Printf("dependency pathspecs: %s\n", pathspecs)
+	return pathspecs, nil
+}
+
+// WithSettings returns a copy of s that runs benchmarks with different build settings.
+func (s *PackageSet) WithSettings(settings bench.Settings) *PackageSet {
+	c := *s
+	c.Settings = settings
+	return &c
+}
+
+// GetBenchmarks returns a mapping {packageImportPath -> benchmarks} at revision.
+// cb is called on each benchmark as soon as it is received.
+func (s *PackageSet) GetBenchmarks(revision, benchRegex string, cb func(*bench.Run)) (map[string]bench.RunSlice, error) {
+	sandbox, err := NewSandbox(s, revision)
+	if err != nil {
+		return nil, err
+	}
+	defer sandbox.Close()
+	return sandbox.GetBenchmarks(benchRegex, cb)
+}
+
+// GetSeriesBenchmarks returns benchmarks of each series at revision.
+// All series share one checkout.
+// Packages that fail to build or test are reported in the Failures of the result.
+func (s *PackageSet) GetSeriesBenchmarks(revision, benchRegex string, series []bench.Series) (*bench.Results, error) {
+	sandbox, err := NewSandbox(s, revision)
+	if err != nil {
+		return nil, err
+	}
+	defer sandbox.Close()
+
+	results := bench.NewResults(len(series))
+	for i, ser := range series {
+		if ser.Name != "" {
+			Verbose.Printf("running series %s\n", ser.Name)
+		}
+		if err := sandbox.WithSettings(ser.Settings).CollectBenchmarks(benchRegex, results, i); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,104 @@
+package repo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nodirt/ggt/internal/fixture"
+)
+
+func TestOpen(t *testing.T) {
+	r := fixture.New(t)
+	r.Package(".")
+	r.Package("bar")
+	r.Commit("first")
+
+	set := openFixture(t, fixture.ImportPath+"/...")
+	if set.Root != r.Dir {
+		t.Errorf("Root = %q, want %q", set.Root, r.Dir)
+	}
+	if set.GitDir != ".git" {
+		t.Errorf("GitDir = %q, want .git", set.GitDir)
+	}
+	if set.RootPackageImportPath != fixture.ImportPath {
+		t.Errorf("RootPackageImportPath = %q, want %q", set.RootPackageImportPath, fixture.ImportPath)
+	}
+	if want := []string{".", "bar"}; !reflect.DeepEqual(set.RelPackagePaths, want) {
+		t.Errorf("RelPackagePaths = %q, want %q", set.RelPackagePaths, want)
+	}
+	if !set.Caching {
+		t.Errorf("Caching is false")
+	}
+}
+
+func TestOpenSubpackage(t *testing.T) {
+	r := fixture.New(t)
+	r.Package("bar/baz")
+	r.Commit("first")
+
+	set := openFixture(t, fixture.ImportPath+"/bar/baz")
+	if set.Root != r.Dir {
+		t.Errorf("Root = %q, want %q", set.Root, r.Dir)
+	}
+	if set.RootPackageImportPath != fixture.ImportPath {
+		t.Errorf("RootPackageImportPath = %q, want %q", set.RootPackageImportPath, fixture.ImportPath)
+	}
+	if want := []string{"bar/baz"}; !reflect.DeepEqual(set.RelPackagePaths, want) {
+		t.Errorf("RelPackagePaths = %q, want %q", set.RelPackagePaths, want)
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	r := fixture.New(t)
+	r.Package(".")
+	r.Commit("first")
+
+	// A package in $GOPATH, but not in a git repository.
+	notInGit := filepath.Join(r.GoPath, "src", "example.com", "nogit")
+	if err := os.MkdirAll(notInGit, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(notInGit, "p.go"), []byte("package p\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, packages := range [][]string{
+		{"example.com/missing"},
+		{"example.com/nogit"},
+		{fixture.ImportPath, "example.com/nogit"},
+	} {
+		if _, err := Open(packages); err == nil {
+			t.Errorf("Open(%s) succeeded, want an error", packages)
+		}
+	}
+}
+
+func TestDependencyPathspecs(t *testing.T) {
+	r := fixture.New(t)
+	r.Package("util")
+	r.WriteFile("p.go", "package p\n\nimport _ \""+fixture.ImportPath+"/util\"\n")
+	r.WriteFile("util/embed.go", "package p\n\nimport _ \"embed\"\n\n//go:embed data.json\nvar data string\n")
+	r.WriteFile("util/data.json", "{}")
+	r.Commit("first")
+
+	set := openFixture(t, fixture.ImportPath)
+	pathspecs, err := set.DependencyPathspecs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{":(top)go.mod", ":(top)go.work", ":(top,glob)*.go", ":(top,glob)util/*.go", ":(top,literal)util/data.json"} {
+		if !containsString(pathspecs, want) {
+			t.Errorf("pathspecs %q do not contain %q", pathspecs, want)
+		}
+	}
+
+	// Dependencies are listed with the chosen toolchain.
+	set.Settings.GoCmd = "ggt-missing-go"
+	if _, err := set.DependencyPathspecs(); err == nil || !strings.Contains(err.Error(), "ggt-missing-go") {
+		t.Errorf("got error %v, want a missing toolchain", err)
+	}
+}
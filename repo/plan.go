@@ -0,0 +1,103 @@
+package repo
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/nodirt/ggt/bench"
+)
+
+// Plan is what GetBenchmarks of a package snapshot would do,
+// judging by the cache.
+type Plan struct {
+	RelPackagePath string
+
+	// Failure is a cached failure that would be returned without running tests.
+	Failure *bench.TestFailedError
+	// Cached are benchmarks that would be loaded from the cache.
+	Cached bench.RunSlice
+	// Run are names of benchmarks that would run.
+	// If NamesKnown is false, other benchmarks may run too.
+	Run []string
+	// NamesKnown is true if names of all benchmarks in the package are cached.
+	NamesKnown bool
+	// ListNames is true if benchmark names would be listed with a separate
+	// `go test` run, before running the missing ones.
+	ListNames bool
+
+	// BuildDuration is the duration of the last build of the package tests.
+	// 0 if unknown.
+	BuildDuration time.Duration
+}
+
+// Complete returns true if GetBenchmarks would not run `go test`.
+func (p *Plan) Complete() bool {
+	return p.Failure != nil || (p.NamesKnown && len(p.Run) == 0)
+}
+
+// Plan returns what GetBenchmarks would do with benchRegex.
+// Only reads the cache, so nothing is built or run.
+// Mirrors GetBenchmarks and loadBenchmarksFromCache.
+func (s *PackageSnapshot) Plan(benchRegex string) (*Plan, error) {
+	s.EnsureCacheLoaded()
+	if benchRegex == "" {
+		benchRegex = "."
+	}
+	compiledBenchRegex, err := regexp.Compile(benchRegex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regexp: %s", benchRegex)
+	}
+
+	p := &Plan{
+		RelPackagePath: s.RelPackagePath,
+		NamesKnown:     s.Cache.AllBenchmarkNames != nil,
+		BuildDuration:  s.Cache.BuildDuration,
+	}
+	if s.Snapshot.Caching {
+		if p.Failure = s.cachedFailure(benchRegex); p.Failure != nil {
+			return p, nil
+		}
+		if len(s.Cache.Benchmarks) > 0 {
+			for i := range s.Cache.Benchmarks {
+				b := &s.Cache.Benchmarks[i]
+				if compiledBenchRegex.MatchString(b.Name) {
+					if err := p.Cached.Add(b); err != nil {
+						return nil, err
+					}
+				}
+			}
+			if s.Cache.BenchmarksIsComplete {
+				p.NamesKnown = true
+				return p, nil
+			}
+			p.ListNames = !p.NamesKnown
+		}
+	}
+	// Without cached results, all matching benchmarks run at once.
+	p.Run = missingBenchmarks(s.Cache.AllBenchmarkNames, compiledBenchRegex, p.Cached)
+	return p, nil
+}
+
+// PlanSeries returns what GetSeriesBenchmarks would do at revision:
+// a plan of each package of each series, in the order of s.RelPackagePaths.
+func (s *PackageSet) PlanSeries(revision, benchRegex string, series []bench.Series) ([][]*Plan, error) {
+	sandbox, err := NewSandbox(s, revision)
+	if err != nil {
+		return nil, err
+	}
+	defer sandbox.Close()
+
+	plans := make([][]*Plan, len(series))
+	for i, ser := range series {
+		snapshot := sandbox.WithSettings(ser.Settings)
+		for j := range snapshot.Packages {
+			plan, err := snapshot.Packages[j].Plan(benchRegex)
+			if err != nil {
+				return nil, err
+			}
+			plans[i] = append(plans[i], plan)
+		}
+	}
+	return plans, nil
+}
@@ -0,0 +1,26 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package repo
+
+import (
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup does nothing: processes started by cmd are not stopped
+// by interruptProcess and killProcess on this platform.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// interruptProcess sends os.Interrupt to p, or kills it where
+// interrupts cannot be sent, e.g. on Windows.
+func interruptProcess(p *os.Process) {
+	if err := p.Signal(os.Interrupt); err != nil {
+		p.Kill()
+	}
+}
+
+// killProcess kills p.
+func killProcess(p *os.Process) {
+	p.Kill()
+}
@@ -0,0 +1,30 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package repo
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup makes cmd start in a new process group, so that
+// interruptProcess and killProcess reach processes that it starts,
+// e.g. the test binary of `go test`.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// interruptProcess sends SIGINT to the process group of p.
+func interruptProcess(p *os.Process) {
+	syscall.Kill(-p.Pid, syscall.SIGINT)
+}
+
+// killProcess kills the process group of p.
+func killProcess(p *os.Process) {
+	syscall.Kill(-p.Pid, syscall.SIGKILL)
+}
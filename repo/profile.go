@@ -0,0 +1,199 @@
+package repo
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/nodirt/ggt/bench"
+	"github.com/nodirt/ggt/store"
+)
+
+// ProfileKinds are kinds of profiles that Profile collects.
+var ProfileKinds = []string{"cpu", "mem", "trace"}
+
+// profileFlags are `go test` flags that write a profile of each kind.
+var profileFlags = map[string]string{
+	"cpu":   "-cpuprofile",
+	"mem":   "-memprofile",
+	"trace": "-trace",
+}
+
+// profileExts are file extensions of profiles of each kind.
+var profileExts = map[string]string{
+	"cpu":   "cpu.pprof",
+	"mem":   "mem.pprof",
+	"trace": "trace.out",
+}
+
+// ValidateProfileKinds returns an error if a kind is not in ProfileKinds.
+func ValidateProfileKinds(kinds []string) error {
+	for _, k := range kinds {
+		if profileFlags[k] == "" {
+			return fmt.Errorf("unknown profile kind %q; expected one of %s", k, strings.Join(ProfileKinds, ", "))
+		}
+	}
+	return nil
+}
+
+// ProfileFilename returns path to a profile of benchmark of the given kind,
+// which is stored next to the cache file.
+func (s *PackageSnapshot) ProfileFilename(benchmark, kind string) string {
+	gitDir := filepath.Join(s.Snapshot.Root, s.Snapshot.GitDir)
+	return store.ProfileFilename(gitDir, s.Snapshot.TreeId, s.RelPackagePath, s.Snapshot.Settings.CacheKey(), benchmark, profileExts[kind])
+}
+
+// Profile returns paths to profiles of benchmark of the given kinds.
+// Missing profiles are collected by running only benchmark with
+// `go test -run=@ -bench=^<benchmark>$` and profiling flags.
+// Profiling slows benchmarks down, so the run is separate from RunBenchmarks
+// and its results are not cached. If caching is disabled, all profiles are
+// collected again.
+func (s *PackageSnapshot) Profile(benchmark string, kinds []string) (map[string]string, error) {
+	if err := ValidateProfileKinds(kinds); err != nil {
+		return nil, err
+	}
+	paths := make(map[string]string, len(kinds))
+	var missing []string
+	for _, k := range kinds {
+		paths[k] = s.ProfileFilename(benchmark, k)
+		if _, err := os.Stat(paths[k]); err != nil || !s.Snapshot.Caching {
+			missing = append(missing, k)
+		}
+	}
+	if len(missing) == 0 {
+		return paths, nil
+	}
+
+	// The test binary is kept by `go test` when profiling; do not litter.
+	binDir, err := tempDir("profile-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(binDir)
+	if err := os.MkdirAll(filepath.Dir(paths[missing[0]]), os.ModePerm); err != nil {
+		return nil, err
+	}
+	// Other benchmarks would distort the profile.
+	args := []string{"-run=@", "-bench=" + exactBenchRegexes([]string{benchmark})[0], "-o", filepath.Join(binDir, "bench.test")}
+	for _, k := range missing {
+		// Profiles are renamed after a successful run, so failed runs leave no partial profiles.
+		args = append(args, profileFlags[k]+"="+paths[k]+".tmp")
+	}
+	test, err := s.goTest(args...)
+	if err != nil {
+		return nil, err
+	}
+	s.progress(nil)
+	var stderr bytes.Buffer
+	test.Stderr = io.MultiWriter(Stderr, &stderr)
+	test.PinCPUs = s.Snapshot.PinCPUs
+	out, err := Output(test)
+	if err != nil {
+		return nil, s.testFailedError(err, []byte(out), stderr.Bytes())
+	}
+	if !strings.Contains(out, benchmark) {
+		return nil, fmt.Errorf("benchmark %s did not run in %s", benchmark, s.RelPackagePath)
+	}
+	for _, k := range missing {
+		if err := os.Rename(paths[k]+".tmp", paths[k]); err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
+
+// ProfileBenchmarks collects profiles of the given kinds of benchmarks in
+// results at revision, see PackageSnapshot.Profile.
+// results are results of series at revision, like GetSeriesBenchmarks returns.
+func (s *PackageSet) ProfileBenchmarks(revision string, series []bench.Series, results *bench.Results, kinds []string) error {
+	sandbox, err := NewSandbox(s, revision)
+	if err != nil {
+		return err
+	}
+	defer sandbox.Close()
+
+	for i, ser := range series {
+		snapshot := sandbox.WithSettings(ser.Settings)
+		for j := range snapshot.Packages {
+			p := &snapshot.Packages[j]
+			for _, b := range results.Benchmarks[i][p.RelPackagePath] {
+				if _, err := p.Profile(b.Name, kinds); err != nil {
+					return fmt.Errorf("could not profile %s at %s: %s", b.Name, revision, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// FindBenchmark returns the only benchmark in s whose name matches benchRegex,
+// and its package. Returns an error if there are none or several.
+func (s *Snapshot) FindBenchmark(benchRegex string) (*PackageSnapshot, string, error) {
+	compiledBenchRegex, err := regexp.Compile(benchRegex)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid regexp: %s", benchRegex)
+	}
+	var pkg *PackageSnapshot
+	var name string
+	var matches []string
+	for i := range s.Packages {
+		p := &s.Packages[i]
+		names, err := p.GetBenchmarkNames()
+		if err != nil {
+			return nil, "", err
+		}
+		for _, n := range names {
+			if compiledBenchRegex.MatchString(n) {
+				pkg, name = p, n
+				matches = append(matches, filepath.Join(p.RelPackagePath, n))
+			}
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, "", fmt.Errorf("no benchmarks match %s", benchRegex)
+	case 1:
+		return pkg, name, nil
+	default:
+		return nil, "", fmt.Errorf("several benchmarks match %s: %s", benchRegex, strings.Join(matches, " "))
+	}
+}
+
+// ProfileBenchmark collects profiles of the given kinds of the only benchmark
+// matching benchRegex at revision, see FindBenchmark and PackageSnapshot.Profile.
+// Returns the benchmark name and paths to profiles.
+func (s *PackageSet) ProfileBenchmark(revision, benchRegex string, kinds []string) (string, map[string]string, error) {
+	sandbox, err := NewSandbox(s, revision)
+	if err != nil {
+		return "", nil, err
+	}
+	defer sandbox.Close()
+
+	pkg, name, err := sandbox.FindBenchmark(benchRegex)
+	if err != nil {
+		return "", nil, fmt.Errorf("at %s: %s", revision, err)
+	}
+	paths, err := pkg.Profile(name, kinds)
+	if err != nil {
+		return "", nil, fmt.Errorf("could not profile %s at %s: %s", name, revision, err)
+	}
+	return name, paths, nil
+}
+
+// RelativeSourcePath returns the path of a source file relative to the repo
+// root, if filename is in a checkout of the repo in a $GOPATH, such as a
+// sandbox. Profiles record source files at the paths they were built from.
+// Returns "" for files outside of the repo.
+func (s *PackageSet) RelativeSourcePath(filename string) string {
+	dir := "/src/" + s.RootPackageImportPath + "/"
+	filename = filepath.ToSlash(filename)
+	if i := strings.LastIndex(filename, dir); i >= 0 {
+		return filename[i+len(dir):]
+	}
+	return ""
+}
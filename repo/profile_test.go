@@ -0,0 +1,56 @@
+package repo
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/nodirt/ggt/internal/fixture"
+)
+
+func TestProfileBenchmark(t *testing.T) {
+	r := fixture.New(t)
+	r.Package(".", "BenchmarkA 100 10 ns/op", "BenchmarkAB 100 20 ns/op", "BenchmarkC/x+y 100 30 ns/op")
+	r.Commit("first")
+	set := openFixture(t, fixture.ImportPath)
+	runs := &goTestRunCounter{r: r}
+
+	if _, _, err := set.ProfileBenchmark("HEAD", "A", []string{"cpu"}); err == nil || !strings.Contains(err.Error(), "several benchmarks match A") {
+		t.Errorf("got error %v, want several matches", err)
+	}
+	runs.newRuns()
+
+	name, paths, err := set.ProfileBenchmark("HEAD", "B$", []string{"cpu", "mem"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "BenchmarkAB" {
+		t.Errorf("got benchmark %s, want BenchmarkAB", name)
+	}
+	for _, kind := range []string{"cpu", "mem"} {
+		if _, err := ioutil.ReadFile(paths[kind]); err != nil {
+			t.Errorf("%s profile: %s", kind, err)
+		}
+	}
+	got := runs.newRuns()
+	if len(got) != 1 || !strings.Contains(got[0], "-bench=^(BenchmarkAB)$") || !strings.Contains(got[0], "-cpuprofile=") || !strings.Contains(got[0], "-memprofile=") {
+		t.Errorf("unexpected go test runs %q", got)
+	}
+
+	// Profiles are reused; only the missing one is collected.
+	if _, _, err := set.ProfileBenchmark("HEAD", "B$", []string{"cpu", "trace"}); err != nil {
+		t.Fatal(err)
+	}
+	got = runs.newRuns()
+	if len(got) != 1 || strings.Contains(got[0], "-cpuprofile=") || !strings.Contains(got[0], "-trace=") {
+		t.Errorf("unexpected go test runs %q", got)
+	}
+
+	// The name is quoted, so metacharacters in sub-benchmark names match literally.
+	if name, _, err = set.ProfileBenchmark("HEAD", `x\+y`, []string{"cpu"}); err != nil {
+		t.Fatal(err)
+	}
+	if got = runs.newRuns(); len(got) != 1 || !strings.Contains(got[0], `-bench=^BenchmarkC$/^x\+y$`) {
+		t.Errorf("unexpected go test runs %q", got)
+	}
+}
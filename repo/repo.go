@@ -0,0 +1,128 @@
+// Package repo runs benchmarks of Go packages in a git repository
+// at any revision and caches results with package store.
+package repo
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+)
+
+// Stderr receives stderr of git and go commands, and warnings.
+var Stderr io.Writer = os.Stderr
+
+// Verbose logs commands and debug info. Discards by default.
+var Verbose = log.New(ioutil.Discard, "", 0)
+
+// Repo is a git repository.
+type Repo struct {
+	Root   string // path to the repo root
+	GitDir string // usually ".git"
+}
+
+// Git creates a git command for the repo.
+func (r *Repo) Git(args ...string) *Command {
+	return Git(r.Root, args...)
+}
+
+// run logs cmd and runs it with CommandRunner.
+// If cmd.Stderr is not set, it is set to Stderr.
+func run(cmd *Command) error {
+	if cmd.Stderr == nil {
+		cmd.Stderr = Stderr
+	}
+	LogCmd(cmd)
+	return CommandRunner.Run(cmd)
+}
+
+// Output runs the command and returns its stdout output with trimmed whitespace.
+// if cmd.Stderr is not set, it is set to Stderr.
+func Output(cmd *Command) (string, error) {
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	err := run(cmd)
+	return strings.TrimSpace(stdout.String()), err
+}
+
+// LogCmd prints the command to Verbose logger.
+func LogCmd(cmd *Command) {
+	Verbose.Println("$ " + cmd.String())
+}
+
+// recordWriter is an io.Writer that calls f for each delim-terminated record.
+// record in f has delim suffix.
+type recordWriter struct {
+	delim byte
+	f     func(record string) error
+	buf   []byte
+	err   error // error returned by f
+}
+
+func (w *recordWriter) Write(data []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	w.buf = append(w.buf, data...)
+	for {
+		i := bytes.IndexByte(w.buf, w.delim)
+		if i < 0 {
+			return len(data), nil
+		}
+		record := string(w.buf[:i+1])
+		w.buf = w.buf[i+1:]
+		if w.err = w.f(record); w.err != nil {
+			return 0, w.err
+		}
+	}
+}
+
+// flush calls f for the last unterminated record, if any.
+func (w *recordWriter) flush() error {
+	if w.err != nil || len(w.buf) == 0 {
+		return w.err
+	}
+	record := string(w.buf)
+	w.buf = nil
+	w.err = w.f(record)
+	return w.err
+}
+
+// ForEachLineOutput runs cmd and invokes f for each line in stdout.
+// line in f may have "\n" suffix.
+func ForEachLineOutput(cmd *Command, f func(line string) error) error {
+	return ForEachRecordOutput(cmd, '\n', f)
+}
+
+// ForEachRecordOutput runs cmd and invokes f for each delim-terminated record in stdout.
+// record in f may have delim suffix.
+// Records are processed even if cmd fails, but errors returned by f take precedence.
+func ForEachRecordOutput(cmd *Command, delim byte, f func(record string) error) error {
+	w := &recordWriter{delim: delim, f: f}
+	cmd.Stdout = w
+	err := run(cmd)
+	if flushErr := w.flush(); flushErr != nil {
+		err = flushErr
+	}
+	return err
+}
+
+// Git creates a git command for the repo at repoPath.
+func Git(repoPath string, args ...string) *Command {
+	return &Command{
+		Path: "git",
+		Args: append([]string{"-C", repoPath}, args...),
+	}
+}
+
+// containsString returns true if list contains elem.
+func containsString(list []string, elem string) bool {
+	for _, a := range list {
+		if a == elem {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,21 @@
+package repo
+
+import (
+	"testing"
+
+	"github.com/nodirt/ggt/internal/fixture"
+)
+
+func TestMain(m *testing.M) {
+	fixture.Main(m)
+}
+
+// openFixture opens packages of a fixture repo.
+func openFixture(t *testing.T, packages ...string) *PackageSet {
+	t.Helper()
+	set, err := Open(packages)
+	if err != nil {
+		t.Fatalf("Open(%s): %s", packages, err)
+	}
+	return set
+}
@@ -0,0 +1,234 @@
+package repo
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nodirt/ggt/bench"
+)
+
+// Command is a process to run: git, go or a test binary.
+type Command struct {
+	Path    string    // name or path of the executable, e.g. "git"
+	Args    []string  // arguments, not including Path
+	Dir     string    // working directory. Empty for the current one.
+	Env     []string  // environment variables in addition to the inherited ones
+	Stdout  io.Writer // receives stdout. Nil to discard.
+	Stderr  io.Writer // receives stderr. Nil to discard.
+	PinCPUs []int     // CPUs to run the process on. Empty to not pin.
+
+	// Limits are resource limits of the process and processes it starts.
+	// Limits.BenchmarkTimeout limits the time between writes to Stdout,
+	// starting from the first one. Limits.Memory limits only test binaries,
+	// see bench.TestBinaryMemory.
+	Limits bench.Limits
+
+	// ReadOnly is true if the command only inspects state, e.g. `git log`.
+	// DryRunner runs only such commands.
+	ReadOnly bool
+}
+
+// String returns cmd as a shell command.
+func (cmd *Command) String() string {
+	var buf bytes.Buffer
+	if cmd.Dir != "" {
+		buf.WriteString("cd " + cmd.Dir + " && ")
+	}
+	for _, e := range cmd.Env {
+		buf.WriteString(strings.TrimSpace(e))
+		buf.WriteString(" ")
+	}
+	buf.WriteString(cmd.Path)
+	for _, a := range cmd.Args {
+		buf.WriteString(" ")
+		buf.WriteString(a)
+	}
+	return buf.String()
+}
+
+// Runner runs commands.
+type Runner interface {
+	// Run runs cmd and waits for it to exit.
+	// If writing to cmd.Stdout fails, the process is stopped and the write
+	// error is returned. If the process exits with a non-zero code, the error
+	// has ExitCode() int method, like *exec.ExitError and *ExitError.
+	// If the process is stopped by Interrupt, the error is ErrInterrupted.
+	// If the process exceeds cmd.Limits, the error is *LimitError.
+	Run(cmd *Command) error
+}
+
+// CommandRunner runs all commands of this package.
+// Replace it to run commands differently, e.g. with fakes in tests.
+var CommandRunner Runner = ExecRunner{}
+
+// ExitError is an error of a command that exited with a non-zero code.
+// Runners other than ExecRunner may return it.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// ExitCode returns the exit code of the command.
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
+
+// LimitError is an error of a command that exceeded its limits.
+type LimitError struct {
+	Kind string // e.g. bench.ExceededTimeout
+}
+
+func (e *LimitError) Error() string {
+	return "exceeded " + e.Kind
+}
+
+// ExceededLimit returns the kind of the exceeded limit.
+func (e *LimitError) ExceededLimit() string {
+	return e.Kind
+}
+
+// memoryCheckInterval is how often ExecRunner checks memory of test binaries
+// against Limits.Memory.
+const memoryCheckInterval = 100 * time.Millisecond
+
+// ExecRunner runs commands as processes on this machine.
+// Processes are stopped together with processes they start,
+// except on platforms other than Linux and macOS.
+type ExecRunner struct{}
+
+// Run implements Runner.
+// Commands are not started after Interrupt.
+func (ExecRunner) Run(c *Command) error {
+	if Interrupted() {
+		return ErrInterrupted
+	}
+	cmd := exec.Command(c.Path, c.Args...)
+	cmd.Dir = c.Dir
+	if len(c.Env) > 0 {
+		cmd.Env = append(os.Environ(), c.Env...)
+	}
+	setProcessGroup(cmd)
+
+	// exceeded is the kind of the exceeded limit. Guarded by mu.
+	// Limits are not checked after the process exits.
+	var mu sync.Mutex
+	exceeded := ""
+	exited := false
+	exceed := func(kind string) {
+		mu.Lock()
+		defer mu.Unlock()
+		if exceeded == "" && !exited {
+			exceeded = kind
+			killProcess(cmd.Process)
+		}
+	}
+
+	cmd.Stderr = c.Stderr
+
+	var stdout io.Reader
+	stdoutW := c.Stdout
+	if c.Stdout != nil {
+		var err error
+		if stdout, err = cmd.StdoutPipe(); err != nil {
+			return err
+		}
+		if limit := c.Limits.BenchmarkTimeout; limit > 0 {
+			idle := time.AfterFunc(limit, func() { exceed(bench.ExceededBenchmarkTimeout) })
+			idle.Stop() // started by the first line
+			defer idle.Stop()
+			stdoutW = io.MultiWriter(c.Stdout, &recordWriter{delim: '\n', f: func(string) error {
+				idle.Reset(limit)
+				return nil
+			}})
+		}
+	}
+
+	start := cmd.Start
+	if len(c.PinCPUs) > 0 {
+		start = func() error { return bench.StartPinned(cmd, c.PinCPUs) }
+	}
+	if err := start(); err != nil {
+		return err
+	}
+	untrack := trackProcess(cmd.Process)
+	defer untrack()
+	if c.Limits.Memory > 0 {
+		// The process leads its process group, see setProcessGroup.
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			check := time.NewTicker(memoryCheckInterval)
+			defer check.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-check.C:
+					if m, err := bench.TestBinaryMemory(cmd.Process.Pid); err == nil && m > int64(c.Limits.Memory) {
+						exceed(bench.ExceededMemory)
+						return
+					}
+				}
+			}
+		}()
+	}
+	if c.Limits.Timeout > 0 {
+		timeout := time.AfterFunc(c.Limits.Timeout, func() { exceed(bench.ExceededTimeout) })
+		defer timeout.Stop()
+	}
+
+	var copyErr error
+	if stdout != nil {
+		// stdout must be read before cmd.Wait, which closes the pipe.
+		if _, copyErr = io.Copy(stdoutW, stdout); copyErr != nil {
+			killProcess(cmd.Process)
+		}
+	}
+	err := cmd.Wait()
+	if copyErr != nil {
+		err = copyErr
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	exited = true
+	switch {
+	case err == nil:
+	case Interrupted():
+		err = ErrInterrupted
+	case exceeded != "":
+		err = &LimitError{Kind: exceeded}
+	}
+	return err
+}
+
+// DryRunner prints commands to W instead of running them.
+// Read-only commands are run with Runner, because other commands
+// depend on their output, e.g. `git log` lists commits to run benchmarks at.
+// Caches are not saved while CommandRunner is a DryRunner, because
+// benchmarks that were not run have no results.
+//
+// DryRunner is for programs that use this package; no ggt flag sets it.
+// `ggt log -dry-run` prints a plan of benchmark runs instead.
+type DryRunner struct {
+	Runner Runner
+	W      io.Writer
+}
+
+// Run implements Runner.
+func (r *DryRunner) Run(cmd *Command) error {
+	if cmd.ReadOnly {
+		return r.Runner.Run(cmd)
+	}
+	_, err := fmt.Fprintln(r.W, cmd)
+	return err
+}
@@ -0,0 +1,238 @@
+package repo
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nodirt/ggt/bench"
+	"github.com/nodirt/ggt/internal/fixture"
+)
+
+// fakeRunner writes chunks to stdout of every command and records them.
+type fakeRunner struct {
+	chunks []string
+	err    error
+	ran    []string
+}
+
+func (r *fakeRunner) Run(cmd *Command) error {
+	r.ran = append(r.ran, cmd.String())
+	for _, c := range r.chunks {
+		if _, err := io.WriteString(cmd.Stdout, c); err != nil {
+			return err
+		}
+	}
+	return r.err
+}
+
+// useRunner sets CommandRunner to r until the test finishes.
+func useRunner(t *testing.T, r Runner) {
+	prev := CommandRunner
+	CommandRunner = r
+	t.Cleanup(func() { CommandRunner = prev })
+}
+
+func TestForEachLineOutput(t *testing.T) {
+	useRunner(t, &fakeRunner{chunks: []string{"a\nb", "c\n", "d"}})
+	var lines []string
+	err := ForEachLineOutput(&Command{Path: "fake"}, func(line string) error {
+		lines = append(lines, line)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a\n", "bc\n", "d"}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("lines %q, want %q", lines, want)
+	}
+}
+
+func TestForEachLineOutputErrors(t *testing.T) {
+	stop := errors.New("stop")
+	useRunner(t, &fakeRunner{chunks: []string{"a\nb\n", "c\n"}, err: &ExitError{Code: 1}})
+	var lines []string
+	err := ForEachLineOutput(&Command{Path: "fake"}, func(line string) error {
+		lines = append(lines, line)
+		if line == "b\n" {
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Errorf("got error %v, want %v", err, stop)
+	}
+	if want := []string{"a\n", "b\n"}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("lines %q, want %q", lines, want)
+	}
+}
+
+func TestExecRunner(t *testing.T) {
+	dir := t.TempDir()
+	var stdout, stderr bytes.Buffer
+	err := ExecRunner{}.Run(&Command{
+		Path:   "sh",
+		Args:   []string{"-c", "pwd; echo $GGT_TEST_VAR; echo oops >&2; exit 3"},
+		Dir:    dir,
+		Env:    []string{"GGT_TEST_VAR=42"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+	exit, ok := err.(interface{ ExitCode() int })
+	if !ok || exit.ExitCode() != 3 {
+		t.Errorf("got error %v, want exit code 3", err)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 2 || filepath.Base(lines[0]) != filepath.Base(dir) || lines[1] != "42" {
+		t.Errorf("unexpected stdout %q", stdout.String())
+	}
+	if stderr.String() != "oops\n" {
+		t.Errorf("stderr %q, want oops", stderr.String())
+	}
+}
+
+func TestDryRunner(t *testing.T) {
+	r := fixture.New(t)
+	r.Package(".", "BenchmarkA 100 10 ns/op")
+	r.Commit("first")
+	set := openFixture(t, fixture.ImportPath)
+
+	var printed bytes.Buffer
+	useRunner(t, &DryRunner{Runner: ExecRunner{}, W: &printed})
+	s, err := NewSandbox(set, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	benchmarks, err := s.Packages[0].GetBenchmarks(".", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(benchmarks) != 0 {
+		t.Errorf("got benchmarks %v, want none", benchmarks)
+	}
+
+	// The checkout and `go test` are printed, but not run.
+	lines := strings.Split(strings.TrimSpace(printed.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "git -C "+r.Dir+" --work-tree=") || !strings.Contains(lines[1], "go test -run=@ -bench=. "+fixture.ImportPath) {
+		t.Errorf("unexpected commands:\n%s", printed.String())
+	}
+	files, err := ioutil.ReadDir(filepath.Join(s.goPath, "src", fixture.ImportPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("files were checked out: %v", files)
+	}
+	if got := r.GoTestRuns(); len(got) != 0 {
+		t.Errorf("go test ran: %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(r.Dir, ".git", "ggt")); !os.IsNotExist(err) {
+		t.Errorf("cache was saved: %v", err)
+	}
+}
+
+func TestFakeRunnerTestFailure(t *testing.T) {
+	r := fixture.New(t)
+	r.Package(".")
+	r.Commit("first")
+	set := openFixture(t, fixture.ImportPath)
+	set.Caching = false
+
+	// Tests can inject failures without a fixture package that fails.
+	runner := &fakeRunner{chunks: []string{"BenchmarkA 100 10 ns/op\n", "FAIL\n"}, err: &ExitError{Code: 1}}
+	useRunner(t, runner)
+	s := NewSnapshot(set, "fake")
+	_, err := s.Packages[0].RunBenchmarks(".", nil)
+	failure, ok := err.(*bench.TestFailedError)
+	if !ok {
+		t.Fatalf("got error %v, want *bench.TestFailedError", err)
+	}
+	if failure.ExitCode != 1 || string(failure.StdoutOutput) != "FAIL\n" {
+		t.Errorf("unexpected failure %+v", failure)
+	}
+	if len(runner.ran) != 1 || !strings.HasPrefix(runner.ran[0], "go test -run=@ -bench=. ") {
+		t.Errorf("unexpected commands %q", runner.ran)
+	}
+}
+
+func TestExecRunnerLimits(t *testing.T) {
+	for _, c := range []struct {
+		script string
+		limits bench.Limits
+		want   string
+	}{
+		// The process group is killed, including the background sleep,
+		// which would keep stdout open.
+		{"(sleep 10; echo late) & wait", bench.Limits{Timeout: 100 * time.Millisecond}, bench.ExceededTimeout},
+		{"echo first; sleep 10", bench.Limits{BenchmarkTimeout: 100 * time.Millisecond}, bench.ExceededBenchmarkTimeout},
+	} {
+		start := time.Now()
+		err := ExecRunner{}.Run(&Command{
+			Path:   "sh",
+			Args:   []string{"-c", c.script},
+			Stdout: ioutil.Discard,
+			Limits: c.limits,
+		})
+		limitErr, ok := err.(*LimitError)
+		if !ok || limitErr.Kind != c.want {
+			t.Errorf("%s: got error %v, want exceeded %s", c.script, err, c.want)
+		}
+		if d := time.Since(start); d > 5*time.Second {
+			t.Errorf("%s: took %s", c.script, d)
+		}
+	}
+}
+
+// TestAllocateHelper uses memory in a test binary started by
+// TestExecRunnerMemoryLimit.
+func TestAllocateHelper(t *testing.T) {
+	if os.Getenv("GGT_TEST_ALLOCATE") != "1" {
+		t.Skip("started by TestExecRunnerMemoryLimit")
+	}
+	mem := make([]byte, 256<<20)
+	for i := 0; i < len(mem); i += os.Getpagesize() {
+		mem[i] = 1
+	}
+	time.Sleep(10 * time.Second)
+	runtime.KeepAlive(mem)
+}
+
+func TestExecRunnerMemoryLimit(t *testing.T) {
+	// A test that prints about running out of memory did not hit the limit.
+	err := ExecRunner{}.Run(&Command{
+		Path:   "sh",
+		Args:   []string{"-c", "echo 'fatal error: runtime: out of memory' >&2; exit 2"},
+		Limits: bench.Limits{Memory: 1 << 30},
+	})
+	if _, ok := err.(*exec.ExitError); !ok {
+		t.Errorf("got error %v, want exit status", err)
+	}
+
+	if !bench.MemoryLimitSupported {
+		return
+	}
+	// The name of this test binary ends with .test.
+	start := time.Now()
+	err = ExecRunner{}.Run(&Command{
+		Path:   os.Args[0],
+		Args:   []string{"-test.run=^TestAllocateHelper$"},
+		Env:    []string{"GGT_TEST_ALLOCATE=1"},
+		Limits: bench.Limits{Memory: 64 << 20},
+	})
+	if limitErr, ok := err.(*LimitError); !ok || limitErr.Kind != bench.ExceededMemory {
+		t.Errorf("got error %v, want exceeded %s", err, bench.ExceededMemory)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("took %s", d)
+	}
+}
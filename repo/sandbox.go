@@ -0,0 +1,93 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nodirt/ggt/bench"
+)
+
+// Sandbox is able to checkout a repo at a revision to a temp dir
+// and initialize Snapshot.GoPath with it.
+// Can be used to run tests on a revision different from HEAD.
+type Sandbox struct {
+	*Snapshot
+	Revision string
+
+	goPath string // GoPath that contains the package at Revision
+}
+
+// NewSandbox creates a sandbox of set at revision.
+// The revision is checked out on first use.
+func NewSandbox(set *PackageSet, revision string) (*Sandbox, error) {
+	gitLog := set.Repo.Git("log", "-1", "--format=%T", revision)
+	gitLog.ReadOnly = true
+	treeId, err := Output(gitLog)
+	if err != nil {
+		return nil, err
+	}
+	Verbose.Printf("treeId of %s is %s\n", revision, treeId)
+
+	s := &Sandbox{
+		Snapshot: NewSnapshot(set, treeId),
+		Revision: revision,
+	}
+	s.InitGoPath = func() (string, error) {
+		var err error
+		if s.goPath == "" {
+			err = s.Open()
+		}
+		return s.goPath, err
+	}
+	return s, nil
+}
+
+// WithSettings returns a snapshot that shares the checkout with s,
+// but runs benchmarks with different build settings.
+func (s *Sandbox) WithSettings(settings bench.Settings) *Snapshot {
+	snapshot := NewSnapshot(s.PackageSet.WithSettings(settings), s.TreeId)
+	snapshot.InitGoPath = s.InitGoPath
+	return snapshot
+}
+
+// Open checks out the repo at the revision to a temp dir.
+func (s *Sandbox) Open() error {
+	if s.goPath != "" {
+		return errors.New("sandbox already open")
+	}
+	goPath, err := tempDir("")
+	if err != nil {
+		return err
+	}
+
+	checkout := filepath.Join(goPath, "src", s.RootPackageImportPath)
+	if err := os.MkdirAll(checkout, os.ModePerm); err != nil {
+		return err
+	}
+	Verbose.Printf("sandboxing to %s...\n", checkout)
+	gitCheckout := s.Repo.Git("--work-tree="+checkout, "checkout", s.Revision, "--", ".")
+	if err = run(gitCheckout); err != nil {
+		os.RemoveAll(goPath)
+		return fmt.Errorf("could not checkout revision %s to %s: %s", s.Revision, checkout, err)
+	}
+
+	s.goPath = goPath
+	trackSandbox(s, true)
+	return nil
+}
+
+// Close attempts to delete s.GoPath if present.
+func (s *Sandbox) Close() error {
+	if s.goPath == "" {
+		return nil
+	}
+	if err := os.RemoveAll(s.goPath); err != nil {
+		fmt.Fprintf(os.Stderr, "could not delete checkout %s: %s\n", s.goPath, err)
+		return err
+	}
+	s.goPath = ""
+	trackSandbox(s, false)
+	return nil
+}
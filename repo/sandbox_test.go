@@ -0,0 +1,87 @@
+package repo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nodirt/ggt/internal/fixture"
+)
+
+func TestSandboxOpenClose(t *testing.T) {
+	r := fixture.New(t)
+	r.Package(".")
+	r.WriteFile("version.txt", "1")
+	first := r.Commit("first")
+	r.WriteFile("version.txt", "2")
+	r.Commit("second")
+
+	set := openFixture(t, fixture.ImportPath)
+	s, err := NewSandbox(set, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := r.Git("log", "-1", "--format=%T", first); s.TreeId != want {
+		t.Errorf("TreeId = %q, want %q", s.TreeId, want)
+	}
+
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	goPath := s.goPath
+	checkout := filepath.Join(goPath, "src", fixture.ImportPath)
+	data, err := ioutil.ReadFile(filepath.Join(checkout, "version.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "1" {
+		t.Errorf("checked out version.txt is %q, want 1", data)
+	}
+	if err := s.Open(); err == nil {
+		t.Errorf("second Open succeeded, want an error")
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(goPath); !os.IsNotExist(err) {
+		t.Errorf("checkout %s was not deleted: %v", goPath, err)
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("second Close: %s", err)
+	}
+}
+
+func TestSandboxOpensLazily(t *testing.T) {
+	r := fixture.New(t)
+	r.Package(".", "BenchmarkA 100 10 ns/op")
+	r.Commit("first")
+
+	set := openFixture(t, fixture.ImportPath)
+	s, err := NewSandbox(set, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if s.goPath != "" {
+		t.Fatalf("sandbox is open before first use")
+	}
+	if _, err := s.GetBenchmarks(".", nil); err != nil {
+		t.Fatal(err)
+	}
+	if s.goPath == "" {
+		t.Errorf("sandbox is not open after running benchmarks")
+	}
+}
+
+func TestNewSandboxInvalidRevision(t *testing.T) {
+	r := fixture.New(t)
+	r.Package(".")
+	r.Commit("first")
+
+	set := openFixture(t, fixture.ImportPath)
+	if _, err := NewSandbox(set, "nonexistent"); err == nil {
+		t.Errorf("NewSandbox succeeded, want an error")
+	}
+}
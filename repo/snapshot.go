@@ -0,0 +1,582 @@
+package repo
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"io"
+
+	"github.com/nodirt/ggt/bench"
+	"github.com/nodirt/ggt/store"
+)
+
+// Snapshot is a package set at a git tree.
+// Benchmarks are run in GoPath, which is initialized lazily by InitGoPath.
+// If both are empty, benchmarks are run in the working tree.
+type Snapshot struct {
+	*PackageSet
+
+	Packages []PackageSnapshot
+	TreeId   string
+
+	InitGoPath func() (string, error)
+	GoPath     string
+}
+
+// NewSnapshot creates a snapshot of set at treeId.
+func NewSnapshot(set *PackageSet, treeId string) *Snapshot {
+	snapshot := Snapshot{
+		PackageSet: set,
+		Packages:   make([]PackageSnapshot, len(set.RelPackagePaths)),
+		TreeId:     treeId,
+	}
+	for i, rpp := range set.RelPackagePaths {
+		snapshot.Packages[i] = PackageSnapshot{
+			RelPackagePath: rpp,
+			Snapshot:       &snapshot,
+		}
+	}
+	return &snapshot
+}
+
+// PackageSnapshot is a package of a Snapshot.
+type PackageSnapshot struct {
+	RelPackagePath string
+	Snapshot       *Snapshot
+	Cache          *store.Cache
+}
+
+// Go creates a go command that runs in the repo snapshot.
+// Initializes s.GoPath if needed.
+func (s *Snapshot) Go(args ...string) (*Command, error) {
+	cmd := &Command{
+		Path: s.Settings.GoCommand(),
+		Args: args,
+		Env:  append(s.Settings.GoEnv(), s.Settings.Env...),
+	}
+	if s.GoPath == "" && s.InitGoPath != nil {
+		var err error
+		if s.GoPath, err = s.InitGoPath(); err != nil {
+			return nil, err
+		}
+	}
+	if s.GoPath != "" {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("GOPATH=%s:%s", s.GoPath, os.Getenv("GOPATH")))
+	}
+	return cmd, nil
+}
+
+// goTest returns a `go test` command for the package with s.Settings applied.
+// args are appended after the test flags from settings, so they take precedence.
+func (s *PackageSnapshot) goTest(args ...string) (*Command, error) {
+	importPath := filepath.Join(s.Snapshot.RootPackageImportPath, s.RelPackagePath)
+	testArgs := append([]string{"test"}, s.Snapshot.Settings.TestFlags...)
+	testArgs = append(testArgs, args...)
+	cmd, err := s.Snapshot.Go(append(testArgs, importPath)...)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Limits = s.Snapshot.Limits
+	return cmd, nil
+}
+
+// testFailedError is bench.NewTestFailedError that records limits
+// of the package set in failures that exceeded them.
+func (s *PackageSnapshot) testFailedError(err error, stdout, stderr []byte) error {
+	err = bench.NewTestFailedError(err, stdout, stderr)
+	if failure, ok := err.(*bench.TestFailedError); ok && failure.Exceeded != "" {
+		limits := s.Snapshot.Limits
+		failure.Limits = &limits
+	}
+	return err
+}
+
+// GetBenchmarks returns a mapping {RelPackagePath -> benchmarks}
+// cb is called on each benchmark as soon as it is received.
+func (s *Snapshot) GetBenchmarks(benchRegex string, cb func(*bench.Run)) (map[string]bench.RunSlice, error) {
+	results := make(map[string]bench.RunSlice, len(s.Packages))
+	for i := range s.Packages {
+		p := &s.Packages[i]
+		var err error
+		results[p.RelPackagePath], err = p.GetBenchmarks(benchRegex, cb)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// CollectBenchmarks stores benchmarks of each package to results as series.
+// Packages that fail to build or test are stored as failures.
+func (s *Snapshot) CollectBenchmarks(benchRegex string, results *bench.Results, series int) error {
+	for i := range s.Packages {
+		p := &s.Packages[i]
+		benchmarks, err := p.GetBenchmarks(benchRegex, nil)
+		if failure, ok := err.(*bench.TestFailedError); ok {
+			results.Failures[series][p.RelPackagePath] = failure
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		results.Benchmarks[series][p.RelPackagePath] = benchmarks
+	}
+	return nil
+}
+
+// cacheFilename returns path to the snapshot cache file.
+func (s *PackageSnapshot) cacheFilename() string {
+	gitDir := filepath.Join(s.Snapshot.Root, s.Snapshot.GitDir)
+	return store.Filename(gitDir, s.Snapshot.TreeId, s.RelPackagePath, s.Snapshot.Settings.CacheKey())
+}
+
+// LoadCache loads s.Cache from the cache file.
+func (s *PackageSnapshot) LoadCache() {
+	if s.Cache == nil {
+		s.Cache = &store.Cache{}
+	}
+	if err := s.Cache.Load(s.cacheFilename()); err != nil {
+		log.Printf("could not load cache: %s\n", err)
+	}
+}
+
+// LoadCache loads s.Cache from the cache file if it was not loaded before.
+func (s *PackageSnapshot) EnsureCacheLoaded() {
+	if s.Cache == nil {
+		s.LoadCache()
+	}
+}
+
+// SaveCache saves s.Cache to the cache file.
+// Does nothing if commands are not run, see DryRunner.
+func (s *PackageSnapshot) SaveCache() {
+	if s.Cache == nil {
+		panic("cache not loaded")
+	}
+	if _, dry := CommandRunner.(*DryRunner); dry {
+		return
+	}
+	if err := s.Cache.Save(s.cacheFilename()); err != nil {
+		log.Printf("could not save test results: %s\n", err)
+	}
+}
+
+// GetBenchmarkNames returns a slice of all benchmark names in the snapshot.
+func (s *PackageSnapshot) GetBenchmarkNames() ([]string, error) {
+	s.EnsureCacheLoaded()
+
+	if s.Cache.AllBenchmarkNames != nil {
+		return s.Cache.AllBenchmarkNames, nil
+	}
+
+	if failure := s.cachedFailure(""); failure != nil {
+		return nil, failure
+	}
+
+	// Newer test binaries reject -benchtime=0, so each benchmark runs once.
+	test, err := s.goTest("-run=@", "-bench=.", "-benchtime=1x")
+	if err != nil {
+		return nil, err
+	}
+	s.progress(nil)
+	var stderr bytes.Buffer
+	test.Stderr = io.MultiWriter(Stderr, &stderr)
+	start := time.Now()
+	out, err := Output(test)
+	testNames := listedBenchmarks(out)
+	var failure *bench.TestFailedError
+	if err != nil {
+		err = s.testFailedError(err, []byte(out), stderr.Bytes())
+		var ok bool
+		if failure, ok = err.(*bench.TestFailedError); !ok {
+			return nil, err
+		}
+		if failure.BuildFailed || failure.Exceeded != "" || len(testNames) == 0 {
+			// No benchmark can run.
+			s.saveFailure(failure, "")
+			return nil, err
+		}
+	}
+
+	s.Cache.AllBenchmarkNames = testNames
+	// Running benchmarks once takes little time compared to the build.
+	s.Cache.BuildDuration = time.Since(start)
+	if failure != nil {
+		// Some benchmarks failed at N=1; others may still run,
+		// so the failure is recorded only for -bench=.
+		s.saveFailure(failure, ".")
+		return testNames, nil
+	}
+	s.clearFailure()
+	s.SaveCache()
+	return testNames, nil
+}
+
+// listedBenchmarks returns names of benchmarks that ran or failed in the
+// output of `go test -bench`. Names of parents of sub-benchmarks that failed
+// are not included, because parents do not report results.
+func listedBenchmarks(out string) []string {
+	names := []string{} // must be non-nil
+	var failed []string
+	for _, line := range strings.Split(out, "\n") {
+		if benchmark := bench.ParseRun(line); benchmark != nil {
+			names = append(names, benchmark.Name)
+		} else if fields := strings.Fields(line); len(fields) >= 3 && fields[0] == "---" && fields[1] == "FAIL:" {
+			failed = append(failed, fields[2])
+		}
+	}
+	for _, name := range failed {
+		isParent := false
+		for _, other := range failed {
+			isParent = isParent || strings.HasPrefix(other, name+"/")
+		}
+		if !isParent && !containsString(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// saveFailure records a failed `go test -bench=<benchRegex>` run in the cache,
+// so it is not retried next time.
+func (s *PackageSnapshot) saveFailure(failure *bench.TestFailedError, benchRegex string) {
+	s.Cache.Failure = failure
+	s.Cache.FailureBenchRegex = benchRegex
+	s.SaveCache()
+}
+
+// clearFailure forgets a failure recorded by saveFailure after a successful run,
+// e.g. with -caching=false or a raised limit, so it does not hide the results.
+func (s *PackageSnapshot) clearFailure() {
+	s.Cache.Failure = nil
+	s.Cache.FailureBenchRegex = ""
+}
+
+// progress reports progress of s to Snapshot.Progress, if set.
+func (s *PackageSnapshot) progress(benchmark *bench.Run) {
+	if f := s.Snapshot.Progress; f != nil {
+		f(s, benchmark)
+	}
+}
+
+// cachedFailure returns the cached failure of a previous run with benchRegex,
+// or nil if there is none or caching is disabled.
+// Build failures and failures to list benchmarks are returned regardless
+// of benchRegex. Failures that exceeded a limit are not returned if the limit
+// was raised since.
+func (s *PackageSnapshot) cachedFailure(benchRegex string) *bench.TestFailedError {
+	f := s.Cache.Failure
+	if !s.Snapshot.Caching || f == nil {
+		return nil
+	}
+	if !f.BuildFailed && s.Cache.FailureBenchRegex != "" && s.Cache.FailureBenchRegex != benchRegex {
+		return nil
+	}
+	if f.Exceeded != "" && f.Limits != nil && s.Snapshot.Limits.Raised(f.Limits, f.Exceeded) {
+		Verbose.Printf("%s %s before, retrying with a higher limit\n", s.RelPackagePath, f)
+		return nil
+	}
+	Verbose.Printf("%s failed before: %s\n", s.RelPackagePath, f)
+	return f
+}
+
+// RunBenchmarks runs `go test -run=@ -bench=<benchRegex>` with build settings
+// of the package set and returns parsed benchmarks.
+// if benchRegex is "", it is defaulted to ".".
+// Results are cached only if the run succeeds; a failed run caches its
+// failure instead, see cachedFailure.
+func (s *PackageSnapshot) RunBenchmarks(benchRegex string, cb func(*bench.Run)) (bench.RunSlice, error) {
+	s.EnsureCacheLoaded()
+	if benchRegex == "" {
+		benchRegex = "."
+	}
+	if failure := s.cachedFailure(benchRegex); failure != nil {
+		return nil, failure
+	}
+
+	test, err := s.goTest("-run=@", "-bench="+benchRegex)
+	if err != nil {
+		return nil, err
+	}
+	s.progress(nil)
+	testNames := []string{} // must be non-nil
+	var result bench.RunSlice
+
+	var stdout, stderr bytes.Buffer
+	test.Stderr = io.MultiWriter(Stderr, &stderr)
+	test.PinCPUs = s.Snapshot.PinCPUs
+	conditions := checkRunConditions(s.Snapshot.PinCPUs)
+	// The test binary prints its first line after the build,
+	// and each benchmark result right after running it.
+	var started, prevLine time.Time
+	start := time.Now()
+	err = ForEachLineOutput(test, func(line string) error {
+		Verbose.Print("\t", line)
+		now := time.Now()
+		if started.IsZero() {
+			started, prevLine = now, now
+		}
+		benchmark := bench.ParseRun(line)
+		if benchmark == nil {
+			stdout.WriteString(line)
+			return nil
+		}
+		benchmark.Conditions = conditions
+		benchmark.Duration = now.Sub(prevLine)
+		prevLine = now
+		Verbose.Println("this is a benchmark")
+		s.progress(benchmark)
+		if cb != nil {
+			cb(benchmark)
+		}
+		if err = result.Add(benchmark); err != nil {
+			return err
+		}
+		testNames = append(testNames, benchmark.Name)
+		return nil
+	})
+	if err == ErrInterrupted {
+		// Cache completed benchmarks, so the next run resumes from them.
+		s.putBenchmarks(result)
+		s.SaveCache()
+		return nil, err
+	}
+	if err != nil {
+		err = s.testFailedError(err, stdout.Bytes(), stderr.Bytes())
+		if failure, ok := err.(*bench.TestFailedError); ok {
+			s.saveFailure(failure, benchRegex)
+		}
+		return nil, err
+	}
+
+	// Results of failed runs are not cached.
+	s.putBenchmarks(result)
+	if !started.IsZero() {
+		s.Cache.BuildDuration = started.Sub(start)
+	}
+	if benchRegex == "." {
+		s.Cache.BenchmarksIsComplete = true
+		s.Cache.AllBenchmarkNames = testNames
+	}
+	s.clearFailure()
+	s.SaveCache()
+
+	return result, nil
+}
+
+// putBenchmarks adds benchmarks to the cache.
+// Results of previous runs are replaced if caching is disabled.
+func (s *PackageSnapshot) putBenchmarks(benchmarks bench.RunSlice) {
+	for i := range benchmarks {
+		s.Cache.Benchmarks.Put(&benchmarks[i])
+	}
+}
+
+// buildTestBinary compiles the test binary of the package to bin
+// with `go test -c`.
+func (s *PackageSnapshot) buildTestBinary(bin string) error {
+	test, err := s.goTest("-c", "-o", bin)
+	if err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	test.Stderr = io.MultiWriter(Stderr, &stderr)
+	out, err := Output(test)
+	if err != nil {
+		return s.testFailedError(err, []byte(out), stderr.Bytes())
+	}
+	return nil
+}
+
+// runTestBinary runs benchmarks matching benchRegex with bin built by
+// buildTestBinary and returns parsed benchmarks. Like `go test`, runs bin
+// in the package dir. Results are not cached.
+func (s *PackageSnapshot) runTestBinary(bin, benchRegex string) (bench.RunSlice, error) {
+	args := append(s.Snapshot.Settings.TestBinaryArgs(), "-test.run=@", "-test.bench="+benchRegex)
+	test := &Command{
+		Path:    bin,
+		Args:    args,
+		Dir:     filepath.Join(s.Snapshot.Root, s.RelPackagePath),
+		Env:     s.Snapshot.Settings.Env,
+		PinCPUs: s.Snapshot.PinCPUs,
+		Limits:  s.Snapshot.Limits,
+	}
+	if s.Snapshot.GoPath != "" {
+		test.Dir = filepath.Join(s.Snapshot.GoPath, "src", s.Snapshot.RootPackageImportPath, s.RelPackagePath)
+	}
+
+	var result bench.RunSlice
+	var stdout, stderr bytes.Buffer
+	test.Stderr = io.MultiWriter(Stderr, &stderr)
+	conditions := checkRunConditions(s.Snapshot.PinCPUs)
+	s.progress(nil)
+	err := ForEachLineOutput(test, func(line string) error {
+		Verbose.Print("\t", line)
+		benchmark := bench.ParseRun(line)
+		if benchmark == nil {
+			stdout.WriteString(line)
+			return nil
+		}
+		benchmark.Conditions = conditions
+		s.progress(benchmark)
+		return result.Add(benchmark)
+	})
+	if err != nil {
+		return nil, s.testFailedError(err, stdout.Bytes(), stderr.Bytes())
+	}
+	return result, nil
+}
+
+// loadBenchmarksFromCache attempts to load benchmarks from cache. If some benchmarks are missing, runs them.
+func (s *PackageSnapshot) loadBenchmarksFromCache(benchRegex string, cb func(*bench.Run)) (bench.RunSlice, error) {
+	s.EnsureCacheLoaded()
+
+	if len(s.Cache.Benchmarks) == 0 {
+		Verbose.Println("nothing in cache")
+		return nil, nil
+	}
+
+	compiledBenchRegex, err := regexp.Compile(benchRegex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regexp: %s", benchRegex)
+	}
+
+	var result bench.RunSlice
+	Verbose.Printf("benchmarks in cache: %v\n", s.Cache.Benchmarks)
+	for i := range s.Cache.Benchmarks {
+		b := &s.Cache.Benchmarks[i]
+		if compiledBenchRegex.MatchString(b.Name) {
+			if cb != nil {
+				cb(b)
+			}
+			if err := result.Add(b); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if !s.Cache.BenchmarksIsComplete {
+		Verbose.Println("not all tests are in cache. Getting full benchmark name list.")
+		all, err := s.GetBenchmarkNames()
+		if err != nil {
+			return nil, err
+		}
+		missing := missingBenchmarks(all, compiledBenchRegex, result)
+		if len(missing) > 0 {
+			Verbose.Printf("the benchmarks loaded from cache miss requested tests: %s.\n", missing)
+			var missingBenchmarks bench.RunSlice
+			for _, regex := range exactBenchRegexes(missing) {
+				runs, err := s.RunBenchmarks(regex, cb)
+				if err != nil {
+					return nil, err
+				}
+				for i := range runs {
+					missingBenchmarks.Put(&runs[i])
+				}
+			}
+			for _, name := range missing {
+				b := missingBenchmarks.Find(name)
+				if b == nil {
+					return nil, fmt.Errorf("requested benchmark %s didn't run.", name)
+				}
+				if err := result.Add(b); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+// exactBenchRegexes returns -bench values that together run exactly the
+// benchmarks names. go test splits -bench by slashes outside of parentheses
+// and matches each part with a level of sub-benchmark names, so top-level
+// benchmarks share one value and each sub-benchmark gets its own, e.g.
+// "^(BenchmarkA|BenchmarkB)$" and "^BenchmarkC$/^x$".
+func exactBenchRegexes(names []string) []string {
+	var top, result []string
+	for _, name := range names {
+		levels := strings.Split(name, "/")
+		if len(levels) == 1 {
+			top = append(top, regexp.QuoteMeta(name))
+			continue
+		}
+		for i, level := range levels {
+			levels[i] = "^" + regexp.QuoteMeta(level) + "$"
+		}
+		result = append(result, strings.Join(levels, "/"))
+	}
+	if len(top) > 0 {
+		result = append([]string{"^(" + strings.Join(top, "|") + ")$"}, result...)
+	}
+	return result
+}
+
+// missingBenchmarks returns names in all that match benchRegex,
+// but are not in cached.
+func missingBenchmarks(all []string, benchRegex *regexp.Regexp, cached bench.RunSlice) []string {
+	var missing []string
+	for _, t := range all {
+		if benchRegex.MatchString(t) && cached.Find(t) == nil {
+			missing = append(missing, t)
+		}
+	}
+	return missing
+}
+
+// GetBenchmarks returns benchmarks from cache or by running them.
+// cb is called as soon as a benchmark is available.
+// benchRegex is defaulted to "."
+// A cached failure of the package is returned before cached results,
+// because results of failed runs are not cached.
+func (s *PackageSnapshot) GetBenchmarks(benchRegex string, cb func(*bench.Run)) (bench.RunSlice, error) {
+	if cb == nil {
+		cb = func(*bench.Run) {}
+	}
+	if benchRegex == "" {
+		benchRegex = "."
+	}
+
+	if s.Snapshot.Caching {
+		s.EnsureCacheLoaded()
+		if failure := s.cachedFailure(benchRegex); failure != nil {
+			return nil, failure
+		}
+		benchmarks, err := s.loadBenchmarksFromCache(benchRegex, cb)
+		if err != nil || benchmarks != nil {
+			return benchmarks, err
+		}
+	}
+
+	return s.RunBenchmarks(benchRegex, cb)
+}
+
+// warnedNoise are kinds of noise warnings printed before.
+// Each kind is printed once.
+var warnedNoise = map[string]bool{}
+
+// checkRunConditions returns the current run conditions of benchmarks
+// pinned to cpus and prints warnings about noise that were not printed before.
+func checkRunConditions(cpus []int) *bench.Conditions {
+	c := bench.ReadConditions(cpus)
+	warnings := c.NoiseWarnings()
+	kinds := make([]string, 0, len(warnings))
+	for kind := range warnings {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		if !warnedNoise[kind] {
+			warnedNoise[kind] = true
+			fmt.Fprintf(Stderr, "warning: %s; benchmark results may be noisy\n", warnings[kind])
+		}
+	}
+	return c
+}
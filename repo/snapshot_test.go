@@ -0,0 +1,317 @@
+package repo
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nodirt/ggt/bench"
+	"github.com/nodirt/ggt/internal/fixture"
+)
+
+// getBenchmarks returns benchmarks of the first package of set at revision,
+// using a new sandbox.
+func getBenchmarks(t *testing.T, set *PackageSet, revision, benchRegex string) (bench.RunSlice, error) {
+	t.Helper()
+	s, err := NewSandbox(set, revision)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	return s.Packages[0].GetBenchmarks(benchRegex, nil)
+}
+
+// nsPerOp formats benchmarks as "name=ns/op" strings.
+func nsPerOp(benchmarks bench.RunSlice) []string {
+	var result []string
+	for _, b := range benchmarks {
+		result = append(result, fmt.Sprintf("%s=%g", b.Name, b.NsPerOp))
+	}
+	return result
+}
+
+// goTestRunCounter tracks `go test` runs of a fixture repo.
+type goTestRunCounter struct {
+	r    *fixture.Repo
+	seen int
+}
+
+// newRuns returns `go test` runs since the previous call.
+func (c *goTestRunCounter) newRuns() []string {
+	runs := c.r.GoTestRuns()
+	result := runs[c.seen:]
+	c.seen = len(runs)
+	return result
+}
+
+func TestGetBenchmarksCache(t *testing.T) {
+	r := fixture.New(t)
+	r.Package(".",
+		"goos: linux",
+		"BenchmarkA 100 10 ns/op",
+		"BenchmarkB 100 20 ns/op",
+		"PASS")
+	r.Commit("first")
+	set := openFixture(t, fixture.ImportPath)
+	runs := &goTestRunCounter{r: r}
+
+	check := func(benchRegex string, want []string, wantRuns ...string) {
+		t.Helper()
+		benchmarks, err := getBenchmarks(t, set, "HEAD", benchRegex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := nsPerOp(benchmarks); !reflect.DeepEqual(got, want) {
+			t.Errorf("-bench=%s: got %q, want %q", benchRegex, got, want)
+		}
+		got := runs.newRuns()
+		if len(got) != len(wantRuns) {
+			t.Fatalf("-bench=%s: go test runs %q, want %d runs with %q", benchRegex, got, len(wantRuns), wantRuns)
+		}
+		for i, want := range wantRuns {
+			if !strings.Contains(got[i], want) {
+				t.Errorf("-bench=%s: go test run %q does not contain %q", benchRegex, got[i], want)
+			}
+		}
+	}
+
+	// Cache miss.
+	check("A$", []string{"BenchmarkA=10"}, "-bench=A$")
+	// Results are cached, but other benchmarks may match A$,
+	// so benchmark names are listed.
+	check("A$", []string{"BenchmarkA=10"}, "-benchtime=1x")
+	// Only the missing benchmark is run.
+	check(".", []string{"BenchmarkA=10", "BenchmarkB=20"}, "-bench=^(BenchmarkB)$")
+	// Cache hit.
+	check("B$", []string{"BenchmarkB=20"})
+
+	// Without caching, benchmarks are always run.
+	set.Caching = false
+	check("B$", []string{"BenchmarkB=20"}, "-bench=B$")
+}
+
+func TestGetBenchmarksCompleteCache(t *testing.T) {
+	r := fixture.New(t)
+	r.Package(".", "BenchmarkA 100 10 ns/op", "BenchmarkB 100 20 ns/op")
+	r.Commit("first")
+	set := openFixture(t, fixture.ImportPath)
+
+	if _, err := getBenchmarks(t, set, "HEAD", "."); err != nil {
+		t.Fatal(err)
+	}
+	runs := len(r.GoTestRuns())
+	benchmarks, err := getBenchmarks(t, set, "HEAD", "B$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := nsPerOp(benchmarks), []string{"BenchmarkB=20"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := r.GoTestRuns()[runs:]; len(got) != 0 {
+		t.Errorf("unexpected go test runs %q", got)
+	}
+}
+
+func TestGetBenchmarksCacheIsPerTree(t *testing.T) {
+	r := fixture.New(t)
+	r.Package(".", "BenchmarkA 100 10 ns/op")
+	first := r.Commit("first")
+	r.Package(".", "BenchmarkA 100 30 ns/op")
+	second := r.Commit("second")
+	set := openFixture(t, fixture.ImportPath)
+
+	for _, c := range []struct {
+		revision string
+		want     []string
+	}{
+		{first, []string{"BenchmarkA=10"}},
+		{second, []string{"BenchmarkA=30"}},
+		{first, []string{"BenchmarkA=10"}},
+	} {
+		benchmarks, err := getBenchmarks(t, set, c.revision, ".")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := nsPerOp(benchmarks); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %q, want %q", c.revision, got, c.want)
+		}
+	}
+	if got := len(r.GoTestRuns()); got != 2 {
+		t.Errorf("go test ran %d times, want 2", got)
+	}
+}
+
+func TestGetBenchmarksBuildFailure(t *testing.T) {
+	r := fixture.New(t)
+	r.Package(".",
+		"stderr: # example.com/foo",
+		"stderr: p.go:1: undefined: x",
+		"FAIL\texample.com/foo [build failed]",
+		"exit 2")
+	r.Commit("first")
+	set := openFixture(t, fixture.ImportPath)
+
+	for _, benchRegex := range []string{".", "A$"} {
+		_, err := getBenchmarks(t, set, "HEAD", benchRegex)
+		failure, ok := err.(*bench.TestFailedError)
+		if !ok {
+			t.Fatalf("-bench=%s: got error %v, want *bench.TestFailedError", benchRegex, err)
+		}
+		if !failure.BuildFailed {
+			t.Errorf("-bench=%s: BuildFailed is false", benchRegex)
+		}
+		if got, want := failure.Excerpt(1), []string{"p.go:1: undefined: x"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("-bench=%s: excerpt %q, want %q", benchRegex, got, want)
+		}
+	}
+	// Build failures are cached regardless of -bench.
+	if got := len(r.GoTestRuns()); got != 1 {
+		t.Errorf("go test ran %d times, want 1", got)
+	}
+}
+
+func TestGetBenchmarksLimitFailure(t *testing.T) {
+	r := fixture.New(t)
+	r.Package(".")
+	r.Commit("first")
+	set := openFixture(t, fixture.ImportPath)
+	runner := &fakeRunner{chunks: []string{"BenchmarkA "}, err: &LimitError{Kind: bench.ExceededTimeout}}
+	useRunner(t, runner)
+
+	for _, c := range []struct {
+		timeout time.Duration
+		runs    int
+	}{
+		{time.Second, 1},
+		{time.Second, 0},     // cached
+		{time.Second / 2, 0}, // cached, a lower limit would be exceeded too
+		{time.Minute, 1},     // retried with a higher limit
+		{0, 1},               // retried without a limit
+	} {
+		set.Limits.Timeout = c.timeout
+		prevRuns := len(runner.ran)
+		_, err := NewSnapshot(set, "fake").Packages[0].GetBenchmarks(".", nil)
+		failure, ok := err.(*bench.TestFailedError)
+		if !ok {
+			t.Fatalf("timeout %s: got error %v, want *bench.TestFailedError", c.timeout, err)
+		}
+		if failure.Exceeded != bench.ExceededTimeout || failure.BuildFailed {
+			t.Errorf("timeout %s: unexpected failure %+v", c.timeout, failure)
+		}
+		if got := len(runner.ran) - prevRuns; got != c.runs {
+			t.Errorf("timeout %s: ran %d commands, want %d", c.timeout, got, c.runs)
+		}
+	}
+}
+
+func TestGetBenchmarksFailureClearedOnSuccess(t *testing.T) {
+	r := fixture.New(t)
+	r.Package(".")
+	r.Commit("first")
+	set := openFixture(t, fixture.ImportPath)
+	get := func() (bench.RunSlice, error) {
+		return NewSnapshot(set, "fake").Packages[0].GetBenchmarks(".", nil)
+	}
+
+	set.Limits.Timeout = time.Second
+	useRunner(t, &fakeRunner{err: &LimitError{Kind: bench.ExceededTimeout}})
+	if _, err := get(); err == nil {
+		t.Fatal("no error")
+	}
+
+	// A retry with a higher limit succeeds.
+	set.Limits.Timeout = time.Minute
+	runner := &fakeRunner{chunks: []string{"BenchmarkA 100 10 ns/op\n"}}
+	useRunner(t, runner)
+	if _, err := get(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The results are loaded from the cache, not hidden by the old failure.
+	set.Limits.Timeout = time.Second
+	benchmarks, err := get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := nsPerOp(benchmarks), []string{"BenchmarkA=10"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if len(runner.ran) != 1 {
+		t.Errorf("ran %q, want one command", runner.ran)
+	}
+}
+
+func TestGetBenchmarksTestFailure(t *testing.T) {
+	r := fixture.New(t)
+	r.Package(".",
+		"BenchmarkA 100 10 ns/op",
+		"--- FAIL: BenchmarkB",
+		"FAIL",
+		"exit 1")
+	r.Commit("first")
+	set := openFixture(t, fixture.ImportPath)
+	runs := &goTestRunCounter{r: r}
+
+	for _, c := range []struct {
+		benchRegex string
+		runs       int
+	}{
+		{".", 1},
+		{".", 0},  // cached
+		{"B$", 1}, // another -bench is retried
+	} {
+		_, err := getBenchmarks(t, set, "HEAD", c.benchRegex)
+		failure, ok := err.(*bench.TestFailedError)
+		if !ok {
+			t.Fatalf("-bench=%s: got error %v, want *bench.TestFailedError", c.benchRegex, err)
+		}
+		if failure.BuildFailed {
+			t.Errorf("-bench=%s: BuildFailed is true", c.benchRegex)
+		}
+		if got := runs.newRuns(); len(got) != c.runs {
+			t.Errorf("-bench=%s: go test runs %q, want %d", c.benchRegex, got, c.runs)
+		}
+	}
+}
+
+func TestGetBenchmarkNamesTestFailure(t *testing.T) {
+	r := fixture.New(t)
+	r.Package(".",
+		"BenchmarkA 1 10 ns/op",
+		"--- FAIL: BenchmarkB",
+		"    --- FAIL: BenchmarkB/x",
+		"        b_test.go:10: oops",
+		"FAIL",
+		"exit 1")
+	r.Commit("first")
+	set := openFixture(t, fixture.ImportPath)
+	runs := &goTestRunCounter{r: r}
+	s, err := NewSandbox(set, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	p := &s.Packages[0]
+
+	// A benchmark that fails when it runs once does not hide the others.
+	for i := 0; i < 2; i++ {
+		names, err := p.GetBenchmarkNames()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"BenchmarkA", "BenchmarkB/x"}; !reflect.DeepEqual(names, want) {
+			t.Errorf("got %q, want %q", names, want)
+		}
+	}
+	if got := runs.newRuns(); len(got) != 1 {
+		t.Errorf("go test runs %q, want 1", got)
+	}
+	if p.cachedFailure(".") == nil {
+		t.Error("the failure is not cached for -bench=.")
+	}
+	if f := p.cachedFailure("^(BenchmarkA)$"); f != nil {
+		t.Errorf("the failure %v is cached for another -bench", f)
+	}
+}
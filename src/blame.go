@@ -0,0 +1,253 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/nodirt/ggt/bench"
+	"github.com/nodirt/ggt/history"
+	"github.com/nodirt/ggt/repo"
+)
+
+// cmdBlame is `ggt blame` command.
+// It attributes the change of a benchmark over a range of commits
+// to the commits that changed it the most.
+type cmdBlame struct {
+	packages      []string
+	benchRegex    string         // must match one benchmark at the newest commit
+	revisionRange string         // will be passed to `git log`
+	count         int            // max number of commits to print
+	settings      bench.Settings // passed to every `go test` run
+}
+
+func (*cmdBlame) name() string {
+	return "blame"
+}
+
+func (*cmdBlame) paged() {}
+
+func (*cmdBlame) shortDescription() string {
+	return "list commits that contributed the most to the current time of a benchmark"
+}
+
+func (*cmdBlame) usage() {
+	fmt.Println("usage: ggt blame [options] -bench=<regex> [revision range] [--] [packages]")
+	fmt.Println()
+	fmt.Println("Commits are walked along first parents, so a merge commit is blamed")
+	fmt.Println("for the changes of the merged branch. The change of the benchmark is")
+	fmt.Println("relative to the parent of the oldest commit in the range. Commits where")
+	fmt.Println("the benchmark failed are skipped; the next commit is compared with the")
+	fmt.Println("nearest ancestor that has a result.")
+	fmt.Println()
+	fmt.Println("Options:")
+	flag.PrintDefaults()
+}
+
+func (b *cmdBlame) parseFlags(args []string) error {
+	flag.StringVar(&b.benchRegex, "bench", "", "regex that matches the benchmark to blame. Must match one benchmark.")
+	flag.IntVar(&b.count, "count", 10, "max number of commits to print")
+	addBuildSettingsFlags(&b.settings)
+	addToolchainFlags(&b.settings)
+	args = parseFlags(args)
+
+	if b.benchRegex == "" {
+		return fmt.Errorf("-bench is required")
+	}
+	if b.count < 1 {
+		return fmt.Errorf("-count must be positive")
+	}
+	if err := b.settings.Validate(); err != nil {
+		return err
+	}
+
+	if len(args) > 0 && args[0] != "--" {
+		b.revisionRange = args[0]
+		args = args[1:]
+	}
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	b.packages = args
+	if len(b.packages) == 0 {
+		return fmt.Errorf("packages are not specified")
+	}
+	return nil
+}
+
+// blamedCommit is a change of the benchmark at a commit.
+type blamedCommit struct {
+	commit    *history.Commit
+	run, prev *bench.Run
+	label     string // describes where prev comes from if not the parent
+}
+
+// change returns the change of ns/op.
+func (c *blamedCommit) change() float64 {
+	return float64(c.run.NsPerOp - c.prev.NsPerOp)
+}
+
+// run prints the change of the benchmark and the commits ranked by their
+// contribution to it.
+//
+// Usage:
+//
+//	ggt blame [options] -bench=<regex> [revision range] [--] [packages]
+//
+// Options:
+//
+//	-bench: regex of the benchmark to blame
+//	-count: max number of commits to print
+//	-testflag, -env, -go, -goroot: same as in ggt log
+func (b *cmdBlame) run() error {
+	set, err := openPackageSet(b.packages)
+	if err != nil {
+		return err
+	}
+	if err := b.settings.ResolveToolchain(); err != nil {
+		return err
+	}
+	set.Settings = b.settings
+	series := []bench.Series{{Settings: b.settings}}
+
+	logArgs := []string{"--first-parent"}
+	if b.revisionRange != "" {
+		logArgs = append(logArgs, b.revisionRange)
+	}
+	hist, err := history.Read(&set.Repo, logArgs...)
+	if err != nil {
+		return err
+	}
+	if len(hist.Commits) == 0 {
+		return fmt.Errorf("no commits in %s", b.revisionRange)
+	}
+	// Revisions in chronological order, starting with the base of the range.
+	commits := make([]*history.Commit, len(hist.Commits))
+	for i, c := range hist.Commits {
+		commits[len(commits)-1-i] = c
+	}
+	revisions := make([]string, 0, len(commits)+1)
+	if parents := commits[0].Parents; len(parents) > 0 {
+		revisions = append(revisions, parents[0])
+	}
+	for _, c := range commits {
+		revisions = append(revisions, c.Id)
+	}
+
+	// The benchmark is resolved at the newest commit.
+	newest := revisions[len(revisions)-1]
+	results, err := set.GetSeriesBenchmarks(newest, b.benchRegex, series)
+	if err != nil {
+		return err
+	}
+	pkg, name, err := findBlamedBenchmark(set, results, b.benchRegex)
+	if err != nil {
+		return fmt.Errorf("at %s: %s", history.ShortId(newest), err)
+	}
+	current := results.Benchmarks[0][pkg].Find(name)
+
+	var blamed []*blamedCommit
+	var base, prev *bench.Run
+	var baseId, prevId string
+	offset := len(revisions) - len(commits) // 1 if revisions start with the base
+	for i, rev := range revisions {
+		run := current
+		if rev != newest {
+			results, err := set.GetSeriesBenchmarks(rev, "^"+regexp.QuoteMeta(name)+"$", series)
+			if err != nil {
+				return err
+			}
+			run = results.Benchmarks[0][pkg].Find(name)
+		}
+		if run == nil {
+			continue
+		}
+		if prev == nil {
+			base, baseId = run, rev
+		} else {
+			c := &blamedCommit{commit: commits[i-offset], run: run, prev: prev}
+			if prevId != revisions[i-1] {
+				c.label = "vs " + history.ShortId(prevId)
+			}
+			blamed = append(blamed, c)
+		}
+		prev, prevId = run, rev
+	}
+
+	formatter, err := newCommitFormatter("oneline")
+	if err != nil {
+		return err
+	}
+	total := float64(current.NsPerOp - base.NsPerOp)
+	current.Annotate(base)
+	var summary table
+	row := summary.Add(name)
+	// more time is worse
+	row.AddChange(formatChange(float64(current.NsPerOpChange)), total > 0)
+	row.cells = append(row.cells,
+		formatNs(float64(base.NsPerOp))+" → "+formatNs(float64(current.NsPerOp)),
+		fmt.Sprintf("since %s, %s", history.ShortId(baseId), pluralize(len(blamed), "commit")))
+	summary.WriteTo(os.Stdout)
+	fmt.Println()
+
+	// The changes of all commits add up to the total change,
+	// so the largest ones explain most of it.
+	sort.SliceStable(blamed, func(i, j int) bool {
+		return math.Abs(blamed[i].change()) > math.Abs(blamed[j].change())
+	})
+	var t table
+	t.Add("delta", "share", "old → new", "commit")
+	for _, c := range blamed {
+		if len(t.rows) > b.count || c.change() == 0 {
+			break
+		}
+		header, err := formatter.Format(c.commit)
+		if err != nil {
+			return err
+		}
+		share := "~"
+		if total != 0 {
+			share = fmt.Sprintf("%.1f%%", 100*c.change()/total)
+		}
+		row := t.Add()
+		row.AddChange(formatNsChange(c.change()), c.change() > 0)
+		row.cells = append(row.cells, share, formatNs(float64(c.prev.NsPerOp))+" → "+formatNs(float64(c.run.NsPerOp)), header)
+		if c.label != "" {
+			row.cells = append(row.cells, "("+c.label+")")
+		}
+	}
+	if len(t.rows) == 1 {
+		fmt.Printf("no changes in %s\n", pluralize(len(blamed), "commit"))
+		return nil
+	}
+	t.WriteTo(os.Stdout)
+	return nil
+}
+
+// findBlamedBenchmark returns the package and name of the only benchmark
+// in results that matches benchRegex.
+func findBlamedBenchmark(set *repo.PackageSet, results *bench.Results, benchRegex string) (pkg, name string, err error) {
+	var matches []string
+	for _, p := range set.RelPackagePaths {
+		if failure := results.Failures[0][p]; failure != nil {
+			return "", "", failure
+		}
+		for _, b := range results.Benchmarks[0][p] {
+			pkg, name = p, b.Name
+			matches = append(matches, filepath.Join(p, b.Name))
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", "", fmt.Errorf("no benchmarks match %s", benchRegex)
+	case 1:
+		return pkg, name, nil
+	default:
+		return "", "", fmt.Errorf("several benchmarks match %s: %s", benchRegex, strings.Join(matches, " "))
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nodirt/ggt/internal/fixture"
+)
+
+func TestBlame(t *testing.T) {
+	r := fixture.New(t)
+	var commits []string
+	commit := func(message string, output ...string) {
+		r.Package(".", output...)
+		commits = append(commits, r.Commit(message))
+	}
+	commit("first", "BenchmarkA 100 100 ns/op", "BenchmarkB 100 100 ns/op")
+	commit("slower", "BenchmarkA 100 150 ns/op", "BenchmarkB 100 100 ns/op")
+	commit("broken", "FAIL\texample.com/foo [build failed]", "exit 2")
+	commit("faster", "BenchmarkA 100 140 ns/op", "BenchmarkB 100 100 ns/op")
+	commit("doc", "BenchmarkA 100 140 ns/op", "BenchmarkB 100 100 ns/op")
+	commit("slowest", "BenchmarkA 100 200 ns/op", "BenchmarkB 100 100 ns/op")
+	short := func(i int) string {
+		return commits[i][:7]
+	}
+
+	// The changes are relative to "first", the base of the range.
+	// "faster" is compared with "slower", because "broken" failed.
+	want := strings.Join([]string{
+		"BenchmarkA  +100%  100ns → 200ns  since " + short(0) + ", 4 commits",
+		"",
+		"delta    share   old → new      commit",
+		"+60.0ns  60.0%   140ns → 200ns  " + short(5) + " slowest",
+		"+50.0ns  50.0%   100ns → 150ns  " + short(1) + " slower",
+		"-10.0ns  -10.0%  150ns → 140ns  " + short(3) + " faster  (vs " + short(1) + ")",
+		"",
+	}, "\n")
+	out, err := runCommand(t, &cmdBlame{}, "-bench=A", commits[0]+"..HEAD", fixture.ImportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != want {
+		t.Errorf("output:\n%s\nwant:\n%s", out, want)
+	}
+
+	// Metacharacters in the resolved name match literally at older commits.
+	commit("sub", "BenchmarkA 100 200 ns/op", "BenchmarkB 100 100 ns/op", "BenchmarkC/x+y 100 50 ns/op")
+	commit("slower sub", "BenchmarkA 100 200 ns/op", "BenchmarkB 100 100 ns/op", "BenchmarkC/x+y 100 100 ns/op")
+	out, err = runCommand(t, &cmdBlame{}, `-bench=C/x\+y`, "HEAD~1..HEAD", fixture.ImportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out, "BenchmarkC/x+y  +100%  50.0ns → 100ns  since "+short(6)) {
+		t.Errorf("unexpected output for a sub-benchmark:\n%s", out)
+	}
+
+	if _, err := runCommand(t, &cmdBlame{}, "-bench=.", "HEAD", fixture.ImportPath); err == nil || !strings.Contains(err.Error(), "several benchmarks match .") {
+		t.Errorf("got error %v, want several matches", err)
+	}
+}
@@ -1,45 +1,73 @@
 package main
 
 import (
-	"encoding/json"
+	"flag"
+	"fmt"
 	"os"
-	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nodirt/ggt/repo"
 )
 
-// packageSnapshotCache stores previously ran benchmarks and known test names.
-type packageSnapshotCache struct {
-	Benchmarks benchmarkRunSlice
-	// BenchmarksIsComplete is true if Benchmarks is a full list of benchmarks
-	// in the package snapshot
-	BenchmarksIsComplete bool
+// unownedTempDirAge is the age of temp dirs without an owner process
+// after which `ggt cache gc` deletes them.
+const unownedTempDirAge = 24 * time.Hour
 
-	AllBenchmarkNames []string // all test names. Nil if unknown.
+// cmdCache is `ggt cache` command.
+// Its only subcommand, gc, deletes temp checkouts left by ggt processes
+// that were killed.
+type cmdCache struct {
+	dryRun bool // true to print dirs instead of deleting them
 }
 
-// Load initializes c state from a file.
-func (c *packageSnapshotCache) Load(filename string) error {
-	*c = packageSnapshotCache{}
-	f, err := os.Open(filename)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
-		return err
-	}
-	defer f.Close()
-	return json.NewDecoder(f).Decode(c)
+func (*cmdCache) name() string {
+	return "cache"
 }
 
-// Save persists c state to a file.
-func (c *packageSnapshotCache) Save(filename string) error {
-	dir := filepath.Dir(filename)
-	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
-		return err
+func (*cmdCache) shortDescription() string {
+	return "manage files of ggt; `ggt cache gc` deletes orphaned temp checkouts"
+}
+
+func (*cmdCache) usage() {
+	fmt.Println("usage: ggt cache gc [options]")
+	fmt.Println()
+	fmt.Println("gc deletes ggt-* temp dirs of ggt processes that are not running,")
+	fmt.Printf("and ggt checkouts without an owner older than %s.\n", formatDuration(unownedTempDirAge))
+	fmt.Println("Other ggt-* dirs are left alone.")
+	fmt.Println()
+	fmt.Println("Options:")
+	flag.PrintDefaults()
+}
+
+func (c *cmdCache) parseFlags(args []string) error {
+	flag.BoolVar(&c.dryRun, "n", false, "print orphaned dirs without deleting them")
+	if len(args) == 0 || args[0] != "gc" {
+		return fmt.Errorf("expected subcommand gc")
+	}
+	if args = parseFlags(args[1:]); len(args) > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(args, " "))
 	}
-	f, err := os.Create(filename)
+	return nil
+}
+
+func (c *cmdCache) run() error {
+	dirs, err := repo.OrphanedTempDirs(time.Now().Add(-unownedTempDirAge))
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	return json.NewEncoder(f).Encode(c)
+	for _, dir := range dirs {
+		if c.dryRun {
+			fmt.Println(dir)
+			continue
+		}
+		verbose.Printf("deleting %s\n", dir)
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+	}
+	if !c.dryRun {
+		fmt.Printf("deleted %s\n", pluralize(len(dirs), "orphaned dir"))
+	}
+	return nil
 }
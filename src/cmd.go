@@ -1,106 +1,25 @@
 package main
 
 import (
-	"bytes"
 	"io"
 	"os"
-	"os/exec"
-	"strings"
-
-	"bufio"
 
 	"github.com/fatih/color"
+	"github.com/nodirt/ggt/repo"
 )
 
 var (
-	red   = color.New(color.FgRed).SprintFunc()
-	green = color.New(color.FgGreen).SprintFunc()
+	red    = color.New(color.FgRed).SprintFunc()
+	green  = color.New(color.FgGreen).SprintFunc()
+	yellow = color.New(color.FgYellow).SprintFunc()
 )
 
-// trimOutput runs the command and returns its stdout output with trimmed whitespace.
-// if cmd.Stderr is not set, it is set to redStderr.
-func trimOutput(cmd *exec.Cmd) (string, error) {
-	if cmd.Stderr == nil {
-		cmd.Stderr = redStderr
-	}
-	logCmd(cmd)
-	out, err := cmd.Output()
-	return strings.TrimSpace(string(out)), err
-}
-
-// logCmd prints the command to verbose logger.
-func logCmd(cmd *exec.Cmd) {
-	if cmd.Dir != "" {
-		panic("we don't specify cmd.Dir")
-	}
-	var buf bytes.Buffer
-	buf.WriteString("$ ")
-	for _, e := range cmd.Env {
-		buf.WriteString(strings.TrimSpace(e))
-		buf.WriteString(" ")
-	}
-	buf.WriteString(strings.Join(cmd.Args, " "))
-	verbose.Println(buf.String())
-}
-
-type lineReader interface {
-	ReadString(delim byte) (string, error)
-}
-
-// forEachLine calls f for each line in .
-// line in f may have "\n"suffix.
-func forEachLine(r lineReader, f func(line string) error) error {
-	for {
-		line, err := r.ReadString('\n')
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return err
-		}
-		if err := f(line); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-// forEachLineOutput runs cmd and invokes f for each line in stdout.
-// line in f may have "\n" suffix.
-func forEachLineOutput(cmd *exec.Cmd, f func(line string) error) error {
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return err
-	}
-	stdoutReader := bufio.NewReader(stdout)
-
-	var lineProcessingErr error
-	go func() {
-		lineProcessingErr = forEachLine(stdoutReader, f)
-	}()
-	logCmd(cmd)
-	err = cmd.Run()
-	if err == nil {
-		err = lineProcessingErr
-	}
-	return err
-}
-
 type writerFunc func([]byte) (n int, err error)
 
 func (f writerFunc) Write(data []byte) (n int, err error) {
 	return f(data)
 }
 
-// git runs git in the repo at repoPath.
-// Redirects stderr to redStderr
-func git(repoPath string, args ...string) *exec.Cmd {
-	firstArgs := []string{"-C", repoPath}
-	cmd := exec.Command("git", append(firstArgs, args...)...)
-	cmd.Stderr = redStderr
-	return cmd
-}
-
 // redStderr is an io.Writer that writes to os.Stderr in red color (unless -colored=false).
 var redStderr = writerFunc(func(data []byte) (n int, err error) {
 	text := string(data)
@@ -110,3 +29,37 @@ var redStderr = writerFunc(func(data []byte) (n int, err error) {
 	os.Stderr.WriteString(text)
 	return len(data), nil
 })
+
+func init() {
+	repo.Stderr = redStderr
+}
+
+// openPackageSet opens packages and applies global flags to the set.
+func openPackageSet(packages []string) (*repo.PackageSet, error) {
+	set, err := repo.Open(packages)
+	if err != nil {
+		return nil, err
+	}
+	set.Caching = caching
+	set.PinCPUs = pinCPUs
+	set.Limits = limits
+	return set, nil
+}
+
+// redirectStderr wraps writers of stderr output with wrap,
+// and returns a function that restores them.
+func redirectStderr(wrap func(io.Writer) io.Writer) (restore func()) {
+	prevStderr := repo.Stderr
+	repo.Stderr = wrap(prevStderr)
+	if verboseFlag {
+		verbose.SetOutput(wrap(os.Stderr))
+		repo.Verbose.SetOutput(wrap(os.Stderr))
+	}
+	return func() {
+		repo.Stderr = prevStderr
+		if verboseFlag {
+			verbose.SetOutput(os.Stderr)
+			repo.Verbose.SetOutput(os.Stderr)
+		}
+	}
+}
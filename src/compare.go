@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/nodirt/ggt/bench"
+)
+
+// cmdCompare is `ggt compare` command.
+// It compares benchmark results of two revisions.
+type cmdCompare struct {
+	packages    []string
+	benchRegex  string         // will be passed to `go test`
+	oldRevision string         // the baseline
+	newRevision string         // the revision to annotate
+	filter      changeFilter   // decides which changes are significant
+	interleave  int            // rounds of interleaved runs of the revisions
+	settings    bench.Settings // passed to every `go test` run
+	matrix      bench.Matrix   // series to run for each revision
+}
+
+func (*cmdCompare) name() string {
+	return "compare"
+}
+
+func (*cmdCompare) paged() {}
+
+func (*cmdCompare) shortDescription() string {
+	return "compare benchmark results of two revisions"
+}
+
+func (*cmdCompare) usage() {
+	fmt.Println("usage: ggt compare [options] <old revision> [<new revision>] [--] [packages]")
+	fmt.Println()
+	fmt.Println("New revision defaults to HEAD.")
+	fmt.Println()
+	fmt.Println("Options:")
+	flag.PrintDefaults()
+}
+
+func (c *cmdCompare) parseFlags(args []string) error {
+	flag.StringVar(&c.benchRegex, "bench", ".", "test name regex")
+	flag.Float64Var(&c.filter.threshold, "threshold", 2.0, "minimum absolute ns/op change to count as a regression or improvement, in percents (0-100).")
+	flag.IntVar(&c.interleave, "interleave", 0, "run test binaries of the revisions in alternation this many times and compare medians, to reduce drift. 0 to disable.")
+	addBuildSettingsFlags(&c.settings)
+	addToolchainFlags(&c.settings)
+	addMatrixFlags(&c.matrix)
+	args = parseFlags(args)
+
+	if c.interleave < 0 {
+		return fmt.Errorf("-interleave must not be negative")
+	}
+	c.filter.only = "all"
+	c.filter.regressionThreshold = -1
+	c.filter.improvementThreshold = -1
+	if err := c.filter.Validate(); err != nil {
+		return err
+	}
+	if err := c.settings.Validate(); err != nil {
+		return err
+	}
+	if err := c.matrix.Validate(); err != nil {
+		return err
+	}
+
+	var revisions []string
+	for len(args) > 0 && args[0] != "--" && len(revisions) < 2 {
+		revisions = append(revisions, args[0])
+		args = args[1:]
+	}
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	switch len(revisions) {
+	case 0:
+		return fmt.Errorf("old revision is not specified")
+	case 1:
+		revisions = append(revisions, "HEAD")
+	}
+	c.oldRevision, c.newRevision = revisions[0], revisions[1]
+
+	c.packages = args
+	if len(c.packages) == 0 {
+		return fmt.Errorf("packages are not specified")
+	}
+	return nil
+}
+
+func (c *cmdCompare) run() error {
+	set, err := openPackageSet(c.packages)
+	if err != nil {
+		return err
+	}
+	if err := c.settings.ResolveToolchain(); err != nil {
+		return err
+	}
+	set.Settings = c.settings
+	series := c.matrix.Series(c.settings)
+
+	oldResults, err := set.GetSeriesBenchmarks(c.oldRevision, c.benchRegex, series)
+	if err != nil {
+		return err
+	}
+	newResults, err := set.GetSeriesBenchmarks(c.newRevision, c.benchRegex, series)
+	if err != nil {
+		return err
+	}
+	oldResults, newResults, err = set.Interleave(c.oldRevision, c.newRevision, series, c.interleave, oldResults, newResults)
+	if err != nil {
+		return err
+	}
+
+	printer := &resultsPrinter{w: os.Stdout, set: set, series: series, significant: c.filter.Significant}
+	printDeltaLegend(os.Stdout)
+	if oldResults.HasFailures() {
+		fmt.Printf("%s:\n\n", c.oldRevision)
+		printer.PrintFailures(oldResults)
+		fmt.Println()
+	}
+	fmt.Printf("%s relative to %s:\n\n", c.newRevision, c.oldRevision)
+	printer.Print(newResults, oldResults.Baseline())
+	return nil
+}
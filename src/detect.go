@@ -0,0 +1,239 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+
+	"github.com/nodirt/ggt/bench"
+	"github.com/nodirt/ggt/history"
+	"github.com/nodirt/ggt/repo"
+)
+
+// cmdDetect is `ggt detect` command.
+// It finds commits where benchmarks shifted to a new level,
+// by running change point detection over results across commits.
+type cmdDetect struct {
+	packages      []string
+	benchRegex    string                    // will be passed to `go test`
+	revisionRange string                    // will be passed to `git log`
+	threshold     float64                   // min abs change of the level to report, in percents
+	detector      bench.ChangePointDetector // configured by flags, except rnd
+	settings      bench.Settings            // passed to every `go test` run
+	matrix        bench.Matrix              // series to run for each commit
+}
+
+func (*cmdDetect) name() string {
+	return "detect"
+}
+
+func (*cmdDetect) paged() {}
+
+func (*cmdDetect) shortDescription() string {
+	return "find commits where benchmarks shifted to a new level"
+}
+
+func (*cmdDetect) usage() {
+	fmt.Println("usage: ggt detect [options] [revision range] [--] [packages]")
+	fmt.Println()
+	fmt.Println("Commits are walked along first parents.")
+	fmt.Println()
+	fmt.Println("Options:")
+	flag.PrintDefaults()
+}
+
+func (d *cmdDetect) parseFlags(args []string) error {
+	flag.StringVar(&d.benchRegex, "bench", ".", "test name regex")
+	flag.Float64Var(&d.threshold, "threshold", 2.0, "minimum absolute change of median ns/op to report, in percents (0-100).")
+	flag.Float64Var(&d.detector.Confidence, "confidence", 0.95, "minimum confidence of a change, in (0, 1).")
+	flag.IntVar(&d.detector.Permutations, "permutations", 199, "number of permutations to test significance of a change with.")
+	flag.IntVar(&d.detector.MinSize, "min-size", 2, "minimum number of commits on each side of a change. Shorter spikes are treated as noise.")
+	addBuildSettingsFlags(&d.settings)
+	addToolchainFlags(&d.settings)
+	addMatrixFlags(&d.matrix)
+	args = parseFlags(args)
+
+	if d.threshold < 0 || d.threshold > 100 {
+		return fmt.Errorf("threshold must be in [0, 100] interval")
+	}
+	if d.detector.Confidence <= 0 || d.detector.Confidence >= 1 {
+		return fmt.Errorf("confidence must be in (0, 1) interval")
+	}
+	if d.detector.Permutations < 1 {
+		return fmt.Errorf("permutations must be positive")
+	}
+	if d.detector.MinSize < 1 {
+		return fmt.Errorf("min size must be positive")
+	}
+	if err := d.settings.Validate(); err != nil {
+		return err
+	}
+	if err := d.matrix.Validate(); err != nil {
+		return err
+	}
+
+	if len(args) > 0 && args[0] != "--" {
+		d.revisionRange = args[0]
+		args = args[1:]
+	}
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	d.packages = args
+	if len(d.packages) == 0 {
+		return fmt.Errorf("packages are not specified")
+	}
+	return nil
+}
+
+// benchmarkKey identifies a benchmark across commits.
+type benchmarkKey struct {
+	series         int
+	relPackagePath string
+	name           string
+}
+
+// benchmarkHistory is results of a benchmark in chronological order.
+// Commits where the benchmark failed or did not exist are omitted.
+type benchmarkHistory struct {
+	key     benchmarkKey
+	commits []int // indexes of commits in chronological order
+	nsPerOp []float64
+}
+
+// detectedChange is a change point of a benchmark.
+type detectedChange struct {
+	benchmarkKey
+	bench.ChangePoint
+}
+
+// run detects and prints level shifts.
+//
+// Usage:
+//
+//	ggt detect [options] [revision range] [--] [packages]
+//
+// Options:
+//
+//	-bench: same as -bench in `go test`
+//	-threshold: min change of the level to report
+//	-confidence: min confidence of a change
+//	-permutations: number of permutations of the significance test
+//	-min-size: min number of commits on each side of a change
+//	-testflag, -env, -go, -goroot, -cpu, -tagset, -envset: same as in ggt log
+func (d *cmdDetect) run() error {
+	set, err := openPackageSet(d.packages)
+	if err != nil {
+		return err
+	}
+	if err := d.settings.ResolveToolchain(); err != nil {
+		return err
+	}
+	set.Settings = d.settings
+	series := d.matrix.Series(d.settings)
+
+	// A level is a property of a line of development,
+	// so merged branches are not walked.
+	logArgs := []string{"--first-parent"}
+	if d.revisionRange != "" {
+		logArgs = append(logArgs, d.revisionRange)
+	}
+	hist, err := history.Read(&set.Repo, logArgs...)
+	if err != nil {
+		return err
+	}
+	// git log lists commits newest first.
+	commits := make([]*history.Commit, len(hist.Commits))
+	for i, c := range hist.Commits {
+		commits[len(commits)-1-i] = c
+	}
+
+	var histories []*benchmarkHistory
+	byKey := map[benchmarkKey]*benchmarkHistory{}
+	for i, commit := range commits {
+		run, err := set.GetSeriesBenchmarks(commit.Id, d.benchRegex, series)
+		if err != nil {
+			return err
+		}
+		for s := range series {
+			for _, pkg := range set.RelPackagePaths {
+				for _, b := range run.Benchmarks[s][pkg] {
+					key := benchmarkKey{s, pkg, b.Name}
+					h := byKey[key]
+					if h == nil {
+						h = &benchmarkHistory{key: key}
+						byKey[key] = h
+						histories = append(histories, h)
+					}
+					h.commits = append(h.commits, i)
+					h.nsPerOp = append(h.nsPerOp, float64(b.NsPerOp))
+				}
+			}
+		}
+	}
+
+	// A fixed seed makes results reproducible for the same cached results.
+	d.detector.Rand = rand.New(rand.NewSource(1))
+	changes := map[int][]detectedChange{} // commit index -> changes
+	for _, h := range histories {
+		for _, p := range d.detector.Detect(h.nsPerOp) {
+			if math.Abs(p.Change()) < d.threshold {
+				continue
+			}
+			commit := h.commits[p.Index]
+			changes[commit] = append(changes[commit], detectedChange{h.key, p})
+		}
+	}
+	if len(changes) == 0 {
+		fmt.Printf("no changes detected in %s\n", pluralize(len(commits), "commit"))
+		return nil
+	}
+
+	formatter, err := newCommitFormatter("oneline")
+	if err != nil {
+		return err
+	}
+	printDeltaLegend(os.Stdout)
+	// Print newest first, like git log.
+	first := true
+	for i := len(commits) - 1; i >= 0; i-- {
+		if len(changes[i]) == 0 {
+			continue
+		}
+		if !first {
+			fmt.Println()
+		}
+		first = false
+		header, err := formatter.Format(commits[i])
+		if err != nil {
+			return err
+		}
+		fmt.Println(header)
+		d.printChanges(set, series, changes[i])
+	}
+	return nil
+}
+
+// printChanges prints changes detected at a commit as a table with columns
+// [series] [package] name delta old→new confidence.
+func (d *cmdDetect) printChanges(set *repo.PackageSet, series []bench.Series, changes []detectedChange) {
+	var t table
+	for _, c := range changes {
+		var cells []string
+		if len(series) > 1 {
+			cells = append(cells, series[c.series].Name)
+		}
+		if len(set.RelPackagePaths) > 1 {
+			cells = append(cells, c.relPackagePath)
+		}
+		row := t.Add(append(cells, c.name)...)
+		// more time is worse
+		row.AddChange(formatChange(c.Change()), c.After > c.Before)
+		row.cells = append(row.cells,
+			formatNs(c.Before)+" → "+formatNs(c.After),
+			fmt.Sprintf("confidence %.1f%%", 100*c.Confidence))
+	}
+	t.WriteTo(os.Stdout)
+}
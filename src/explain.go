@@ -0,0 +1,221 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/google/pprof/profile"
+	"github.com/nodirt/ggt/bench"
+	"github.com/nodirt/ggt/history"
+	"github.com/nodirt/ggt/repo"
+)
+
+// cmdExplain is `ggt explain` command.
+// It compares CPU profiles of a benchmark at a commit and its parent
+// and lists functions whose time changed the most.
+type cmdExplain struct {
+	packages   []string
+	benchRegex string         // must match one benchmark
+	revision   string         // commit to explain
+	count      int            // max number of functions to print
+	byCum      bool           // true to rank functions by cumulative time
+	settings   bench.Settings // passed to every `go test` run
+}
+
+func (*cmdExplain) name() string {
+	return "explain"
+}
+
+func (*cmdExplain) paged() {}
+
+func (*cmdExplain) shortDescription() string {
+	return "list functions whose time changed the most in a commit"
+}
+
+func (*cmdExplain) usage() {
+	fmt.Println("usage: ggt explain [options] -bench=<regex> <commit> [--] [packages]")
+	fmt.Println()
+	fmt.Println("The commit is compared with its first parent. Time of a function is its share")
+	fmt.Println("of CPU profile samples times time/op of the benchmark, so it is an estimate.")
+	fmt.Println("Functions in files changed by the commit are shown with their diffstat.")
+	fmt.Println()
+	fmt.Println("Options:")
+	flag.PrintDefaults()
+}
+
+func (e *cmdExplain) parseFlags(args []string) error {
+	flag.StringVar(&e.benchRegex, "bench", "", "regex that matches the benchmark to explain. Must match one benchmark.")
+	flag.IntVar(&e.count, "count", 10, "max number of functions to print")
+	flag.BoolVar(&e.byCum, "cum", false, "rank functions by change of cumulative time instead of flat time")
+	addBuildSettingsFlags(&e.settings)
+	addToolchainFlags(&e.settings)
+	args = parseFlags(args)
+
+	if e.benchRegex == "" {
+		return fmt.Errorf("-bench is required")
+	}
+	if e.count < 1 {
+		return fmt.Errorf("-count must be positive")
+	}
+	if err := e.settings.Validate(); err != nil {
+		return err
+	}
+
+	if len(args) == 0 || args[0] == "--" {
+		return fmt.Errorf("commit is not specified")
+	}
+	e.revision = args[0]
+	args = args[1:]
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	e.packages = args
+	if len(e.packages) == 0 {
+		return fmt.Errorf("packages are not specified")
+	}
+	return nil
+}
+
+// explainedRevision is a benchmark's result and function times at a revision.
+type explainedRevision struct {
+	run   *bench.Run
+	times map[string]bench.FunctionTime // keyed by function name
+}
+
+// run prints the benchmark change and the ranked functions.
+//
+// Usage:
+//
+//	ggt explain [options] -bench=<regex> <commit> [--] [packages]
+//
+// Options:
+//
+//	-bench: regex of the benchmark to explain
+//	-count: max number of functions to print
+//	-cum: rank functions by cumulative time
+//	-testflag, -env, -go, -goroot: same as in ggt log
+func (e *cmdExplain) run() error {
+	set, err := openPackageSet(e.packages)
+	if err != nil {
+		return err
+	}
+	if err := e.settings.ResolveToolchain(); err != nil {
+		return err
+	}
+	set.Settings = e.settings
+
+	hist, err := history.Read(&set.Repo, "-1", e.revision)
+	if err != nil {
+		return err
+	}
+	if len(hist.Commits) == 0 {
+		return fmt.Errorf("commit %s not found", e.revision)
+	}
+	commit := hist.Commits[0]
+	if len(commit.Parents) == 0 {
+		return fmt.Errorf("commit %s has no parent", commit.ShortId())
+	}
+	parent := commit.Parents[0]
+
+	// The benchmark is resolved at the commit and must exist at the parent.
+	newRev, err := e.explainRevision(set, commit.Id, e.benchRegex)
+	if err != nil {
+		return err
+	}
+	name := newRev.run.Name
+	oldRev, err := e.explainRevision(set, parent, "^"+regexp.QuoteMeta(name)+"$")
+	if err != nil {
+		return err
+	}
+	changes := bench.DiffFunctionTimes(oldRev.times, newRev.times, e.byCum)
+
+	stats, err := history.DiffStat(&set.Repo, parent, commit.Id)
+	if err != nil {
+		return err
+	}
+	statByPath := make(map[string]*history.FileStat, len(stats))
+	for i := range stats {
+		statByPath[stats[i].Path] = &stats[i]
+	}
+
+	formatter, err := newCommitFormatter("oneline")
+	if err != nil {
+		return err
+	}
+	header, err := formatter.Format(commit)
+	if err != nil {
+		return err
+	}
+	fmt.Println(header)
+	var summary table
+	row := summary.Add(name)
+	newRev.run.Annotate(oldRev.run)
+	// more time is worse
+	row.AddChange(formatChange(float64(newRev.run.NsPerOpChange)), newRev.run.NsPerOpChange > 0)
+	row.cells = append(row.cells, formatNs(float64(oldRev.run.NsPerOp))+" → "+formatNs(float64(newRev.run.NsPerOp)))
+	summary.WriteTo(os.Stdout)
+	fmt.Println()
+
+	var t table
+	t.Add("flat", "cum", "function", "file", "diffstat")
+	for i := 0; i < len(changes) && len(t.rows) <= e.count; i++ {
+		c := &changes[i]
+		if c.Flat() == 0 && c.Cum() == 0 {
+			continue
+		}
+		row := t.Add()
+		row.AddChange(formatNsChange(c.Flat()), c.Flat() > 0)
+		row.AddChange(formatNsChange(c.Cum()), c.Cum() > 0)
+		file := set.RelativeSourcePath(c.File)
+		row.cells = append(row.cells, c.Name, file)
+		if s := statByPath[file]; s != nil {
+			row.cells = append(row.cells, s.String())
+		}
+	}
+	if len(t.rows) == 1 {
+		fmt.Println("no function changed its time")
+		return nil
+	}
+	t.WriteTo(os.Stdout)
+	return nil
+}
+
+// explainRevision returns the result of the only benchmark matching
+// benchRegex at revision and time/op of functions in its CPU profile.
+func (e *cmdExplain) explainRevision(set *repo.PackageSet, revision, benchRegex string) (*explainedRevision, error) {
+	name, paths, err := set.ProfileBenchmark(revision, benchRegex, []string{"cpu"})
+	if err != nil {
+		return nil, err
+	}
+	p, err := readProfile(paths["cpu"])
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := set.GetBenchmarks(revision, "^"+regexp.QuoteMeta(name)+"$", nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, benchmarks := range results {
+		if b := benchmarks.Find(name); b != nil {
+			return &explainedRevision{b, bench.FunctionTimes(p, float64(b.NsPerOp))}, nil
+		}
+	}
+	return nil, fmt.Errorf("no results of %s at %s", name, history.ShortId(revision))
+}
+
+// readProfile parses a profile file.
+func readProfile(filename string) (*profile.Profile, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	p, err := profile.Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse profile %s: %s", filename, err)
+	}
+	return p, nil
+}
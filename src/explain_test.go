@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nodirt/ggt/internal/fixture"
+)
+
+func TestExplain(t *testing.T) {
+	r := fixture.New(t)
+	r.Package(".", "BenchmarkA 100 100 ns/op", "BenchmarkB 100 100 ns/op", "BenchmarkC/x+y 100 50 ns/op")
+	r.WriteFile("sum.go", "package p\n")
+	r.WriteFile(fixture.ProfileFile, strings.Join([]string{
+		"p.Run@p.go;p.sum@sum.go 20",
+		"p.Run@p.go;p.parse@parse.go 20",
+		"p.Run@p.go 10",
+	}, "\n"))
+	r.Commit("first")
+	r.Package(".", "BenchmarkA 100 200 ns/op", "BenchmarkB 100 100 ns/op", "BenchmarkC/x+y 100 100 ns/op")
+	r.WriteFile("sum.go", "package p\n\n// slower\n")
+	r.WriteFile(fixture.ProfileFile, strings.Join([]string{
+		"p.Run@p.go;p.sum@sum.go 60",
+		"p.Run@p.go;p.parse@parse.go 20",
+		"p.Run@p.go 20",
+	}, "\n"))
+	commit := r.Commit("slower sum")
+
+	// Time of a function is its share of samples times ns/op:
+	// p.sum takes 20/50*100ns before and 60/100*200ns after.
+	want := strings.Join([]string{
+		commit[:7] + " slower sum",
+		"BenchmarkA  +100%  100ns → 200ns",
+		"",
+		"flat     cum      function  file    diffstat",
+		"+80.0ns  +80.0ns  p.sum     sum.go  +2 -0",
+		"+20.0ns  +100ns   p.Run     p.go",
+		"",
+	}, "\n")
+	out, err := runCommand(t, &cmdExplain{}, "-bench=A", "HEAD", fixture.ImportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != want {
+		t.Errorf("output:\n%s\nwant:\n%s", out, want)
+	}
+
+	out, err = runCommand(t, &cmdExplain{}, "-bench=A", "-cum", "-count=1", "HEAD", fixture.ImportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(out, "\n"); len(lines) != 6 || !strings.Contains(lines[4], "p.Run") {
+		t.Errorf("unexpected output with -cum:\n%s", out)
+	}
+
+	// Metacharacters in the resolved name match literally at the parent.
+	out, err = runCommand(t, &cmdExplain{}, `-bench=C/x\+y`, "HEAD", fixture.ImportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(out, "\n"); len(lines) < 2 || lines[1] != "BenchmarkC/x+y  +100%  50.0ns → 100ns" {
+		t.Errorf("unexpected output for a sub-benchmark:\n%s", out)
+	}
+}
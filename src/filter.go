@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/nodirt/ggt/bench"
+)
+
+// changeFilter decides which benchmark changes are displayed.
+type changeFilter struct {
+	only                 string        // "regressions", "improvements" or "all"
+	threshold            float64       // min abs NsPerOpChange, in percents
+	regressionThreshold  float64       // overrides threshold for regressions if not -1
+	improvementThreshold float64       // overrides threshold for improvements if not -1
+	minDelta             time.Duration // min abs difference of ns/op
+	showNew              bool          // true to display benchmarks without a baseline if only is "all"
+}
+
+// Validate returns an error if f has invalid values.
+func (f *changeFilter) Validate() error {
+	switch f.only {
+	case "all", "regressions", "improvements":
+	default:
+		return fmt.Errorf("-only must be regressions, improvements or all")
+	}
+	for _, t := range []float64{f.threshold, f.regressionThreshold, f.improvementThreshold} {
+		if t > 100 {
+			return fmt.Errorf("thresholds must be in [0, 100] interval")
+		}
+	}
+	if f.threshold < 0 {
+		return fmt.Errorf("threshold must be in [0, 100] interval")
+	}
+	// -1 means the threshold is not set.
+	for _, t := range []float64{f.regressionThreshold, f.improvementThreshold} {
+		if t < 0 && t != -1 {
+			return fmt.Errorf("thresholds must be in [0, 100] interval")
+		}
+	}
+	if f.minDelta < 0 {
+		return fmt.Errorf("min delta must not be negative")
+	}
+	return nil
+}
+
+// Match returns true if the change of b relative to prev passes the filter.
+// b must be annotated relative to prev.
+// prev is nil if b has no baseline, e.g. b is new. Such benchmarks have no
+// change, so they match only if f.only is "all" and f.showNew is true.
+func (f *changeFilter) Match(b, prev *bench.Run) bool {
+	if prev == nil {
+		return f.only == "all" && f.showNew
+	}
+	change := float64(b.NsPerOpChange)
+	regression := change > 0
+	switch {
+	case f.only != "all" && change == 0:
+		return false
+	case f.only == "regressions" && !regression:
+		return false
+	case f.only == "improvements" && regression:
+		return false
+	}
+	return f.Significant(b, prev)
+}
+
+// Significant returns true if the change of b relative to prev exceeds
+// thresholds of the filter, regardless of its direction.
+// b must be annotated relative to prev.
+func (f *changeFilter) Significant(b, prev *bench.Run) bool {
+	change := float64(b.NsPerOpChange)
+	regression := change > 0
+	threshold := f.threshold
+	if regression && f.regressionThreshold >= 0 {
+		threshold = f.regressionThreshold
+	}
+	if !regression && f.improvementThreshold >= 0 {
+		threshold = f.improvementThreshold
+	}
+	if math.Abs(change) < threshold {
+		return false
+	}
+
+	delta := math.Abs(float64(b.NsPerOp - prev.NsPerOp))
+	return delta >= float64(f.minDelta.Nanoseconds())
+}
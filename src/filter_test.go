@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestChangeFilterValidate(t *testing.T) {
+	for _, c := range []struct {
+		regression, improvement float64
+		valid                   bool
+	}{
+		{-1, -1, true},
+		{0, 5, true},
+		{-2, -1, false},
+		{-1, -0.5, false},
+		{101, -1, false},
+	} {
+		f := &changeFilter{only: "all", threshold: 2, regressionThreshold: c.regression, improvementThreshold: c.improvement}
+		if err := f.Validate(); (err == nil) != c.valid {
+			t.Errorf("regression %g, improvement %g: got error %v, want valid %t", c.regression, c.improvement, err, c.valid)
+		}
+	}
+}
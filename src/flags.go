@@ -5,18 +5,54 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
+	"github.com/nodirt/ggt/bench"
+	"github.com/nodirt/ggt/repo"
 )
 
 var (
-	verboseFlag bool // true to prints debug info
-	colored     bool // false to disable colored output
-	caching     bool // true to try to load test results from cache.
+	verboseFlag bool          // true to prints debug info
+	colored     bool          // false to disable colored output
+	caching     bool          // true to try to load test results from cache.
+	noPager     bool          // true to never pipe output to a pager
+	pinCPUs     bench.CPUList // CPUs to run benchmarks on. Empty to not pin.
+	limits      bench.Limits  // limits of benchmark runs
 )
 
 func init() {
+	addGlobalFlags()
+}
+
+// addGlobalFlags registers flags common to all commands.
+func addGlobalFlags() {
 	flag.BoolVar(&verboseFlag, "verbose", false, "print lots of stuff")
-	flag.BoolVar(&colored, "colored", true, "print colored output")
+	flag.BoolVar(&colored, "colored", true, "print colored output. Defaults to false if stdout is not a terminal or $NO_COLOR is set")
 	flag.BoolVar(&caching, "caching", true, "use on-disk cache for test results")
+	flag.BoolVar(&noPager, "no-pager", false, "do not pipe output to a pager")
+	flag.Var(&pinCPUs, "pin", "CPUs to pin benchmark runs to, including their builds, e.g. -pin=2,3 or -pin=0-3. Linux only.")
+	flag.DurationVar(&limits.Timeout, "package-timeout", 0, "max duration of a benchmark run of a package, including the build, e.g. 10m. Runs that exceed it are cached as timed out.")
+	flag.DurationVar(&limits.BenchmarkTimeout, "bench-timeout", 0, "max duration of a benchmark, e.g. 1m. Runs that exceed it are cached as timed out.")
+	flag.Var(&limits.Memory, "memory-limit", "max resident memory of the test binary of a benchmark run, excluding the build, e.g. 4GiB. Runs that exceed it are killed and cached as out of memory. Linux only.")
+}
+
+// stdoutIsTerminal is true if the original stdout is a terminal.
+var stdoutIsTerminal = isatty.IsTerminal(os.Stdout.Fd()) || isatty.IsCygwinTerminal(os.Stdout.Fd())
+
+// stderrIsTerminal is true if stderr is a terminal.
+var stderrIsTerminal = isatty.IsTerminal(os.Stderr.Fd()) || isatty.IsCygwinTerminal(os.Stderr.Fd())
+
+// flagIsSet returns true if the flag was specified on the command line.
+func flagIsSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
 
 // verbose is a *log.Logger for verbose output.
@@ -31,9 +67,22 @@ func parseFlags(args []string) []string {
 		fatal(err)
 	}
 	args = restoreDashes(flag.Args())
+	if len(pinCPUs) > 0 && !bench.PinningSupported {
+		fatal("-pin is supported only on Linux")
+	}
+	if limits.Memory > 0 && !bench.MemoryLimitSupported {
+		fatal("-memory-limit is supported only on Linux")
+	}
 	if verboseFlag {
 		verbose = log.New(os.Stderr, "# ", 0)
+		repo.Verbose = verbose
+	}
+	if !flagIsSet("colored") {
+		// https://no-color.org: only a non-empty NO_COLOR disables colors.
+		colored = stdoutIsTerminal && os.Getenv("NO_COLOR") == ""
 	}
+	// The output may go to a pager, so the color package must not detect it.
+	color.NoColor = !colored
 	return args
 }
 
@@ -56,3 +105,44 @@ func containsString(list []string, elem string) bool {
 	}
 	return false
 }
+
+// stringList is a flag.Value that accumulates values of a repeated flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// addBuildSettingsFlags registers flags that populate s.
+func addBuildSettingsFlags(s *bench.Settings) {
+	flag.Var((*stringList)(&s.TestFlags), "testflag", "go test flag to pass to every benchmark run, e.g. -testflag=-benchtime=3s. May be repeated.")
+	flag.Var((*stringList)(&s.Env), "env", "environment variable for every benchmark run, e.g. -env=GOGC=off. May be repeated.")
+}
+
+// addToolchainFlags registers flags that select the Go toolchain in s.
+func addToolchainFlags(s *bench.Settings) {
+	flag.StringVar(&s.GoCmd, "go", "", "go binary to run benchmarks with, e.g. go1.21.0. Defaults to go in $PATH.")
+	flag.StringVar(&s.GoRoot, "goroot", "", "GOROOT of the toolchain to run benchmarks with.")
+}
+
+// addMatrixFlags registers flags that populate m.
+func addMatrixFlags(m *bench.Matrix) {
+	flag.StringVar(&m.CPUs, "cpu", "", "comma-separated GOMAXPROCS values; each value is a separate series, e.g. -cpu=1,4,16.")
+	flag.Var((*stringList)(&m.TagSets), "tagset", "build tags of a series, e.g. -tagset=purego -tagset=. May be repeated.")
+	flag.Var((*stringList)(&m.EnvSets), "envset", "space-separated environment variables of a series, e.g. -envset=GOAMD64=v3. May be repeated.")
+}
+
+// addChangeFilterFlags registers flags that populate f.
+func addChangeFilterFlags(f *changeFilter) {
+	flag.StringVar(&f.only, "only", "all", "changes to display: regressions, improvements or all.")
+	flag.Float64Var(&f.threshold, "threshold", 2.0, "minimum absolute ns/op change to display, in percents (0-100).")
+	flag.Float64Var(&f.regressionThreshold, "regression-threshold", -1, "minimum ns/op increase to display, in percents. Defaults to -threshold.")
+	flag.Float64Var(&f.improvementThreshold, "improvement-threshold", -1, "minimum ns/op decrease to display, in percents. Defaults to -threshold.")
+	flag.DurationVar(&f.minDelta, "min-delta", 0, "minimum absolute ns/op change to display, e.g. 10ns.")
+	flag.BoolVar(&f.showNew, "new", true, "display benchmarks without a baseline, such as new benchmarks or those of the root commit. They have no change, so they are never displayed with -only=regressions or -only=improvements.")
+}
@@ -1,31 +1,49 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
 	"flag"
 	"fmt"
 	"io"
+	"math"
 	"os"
+	"sort"
 	"strings"
-)
 
-// commitTestRun stores result of a test run for a git commit.
-type commitTestRun struct {
-	benchmarks map[string]benchmarkRunSlice
-	failed     *TestFailedError
-}
+	"github.com/nodirt/ggt/bench"
+	"github.com/nodirt/ggt/history"
+	"github.com/nodirt/ggt/repo"
+)
 
 type cmdLog struct {
 	packages      []string
-	benchRegex    string // will be passed to `go test`
-	revisionRange string // will be passed to `git log`
-	nsPerOpThreshold float64 // min abs NsPerOpChange to display
+	benchRegex    string       // will be passed to `go test`
+	revisionRange string       // will be passed to `git log`
+	filter        changeFilter // benchmark changes to display
+	hideUnchanged bool         // true to hide commits without displayed changes
+	affecting     bool         // true to walk only commits that modify the packages or their dependencies
+	firstParent   bool         // true to follow only the first parent of merge commits
+	allParents    bool         // true to compare merge commits with each parent
+	pretty        string       // commit header format, see prettyFormats
+	oneline       bool         // shorthand for -pretty=oneline
+	formatter     *commitFormatter
+	sort          string         // commit order: "history" or "impact"
+	interleave    int            // rounds of interleaved runs of each commit and its parent
+	dryRun        bool           // true to print what would be done instead of running benchmarks
+	progress      bool           // true to display progress on stderr
+	profile       string         // comma-separated kinds of profiles to collect, see repo.ProfileKinds
+	profileKinds  []string       // parsed profile
+	prog          *progress      // displays progress. Nil if disabled.
+	settings      bench.Settings // passed to every `go test` run
+	matrix        bench.Matrix   // series to run for each commit
 }
 
 func (*cmdLog) name() string {
 	return "log"
 }
 
+func (*cmdLog) paged() {}
+
 func (*cmdLog) shortDescription() string {
 	return "git log with changed benchmark results"
 }
@@ -37,25 +55,56 @@ func (*cmdLog) usage() {
 	flag.PrintDefaults()
 }
 
-// annotate computes nextRun.NsPerOpChange relative to r.
-func (*cmdLog) annotate(r *commitTestRun, nextRun *benchmarkRun, relPackagePath string) {
-	benchmarks, ok := r.benchmarks[relPackagePath]
-	if !ok {
-		return
-	}
-	prev := benchmarks.Find(nextRun.Name)
-	if prev != nil {
-		nextRun.Annotate(prev)
-	}
-}
-
 func (l *cmdLog) parseFlags(args []string) error {
 	flag.StringVar(&l.benchRegex, "bench", ".", "test name regex")
-	flag.Float64Var(&l.nsPerOpThreshold, "threshold", 2.0, "minimum absolute ns/op change to display, in percents (0-100).")
+	flag.BoolVar(&l.hideUnchanged, "hide-unchanged", false, "do not print commits without displayed changes or failures")
+	flag.StringVar(&l.pretty, "pretty", "medium", "commit header format: oneline, short, medium, full or a Go template, e.g. '{{.ShortId}} {{.AuthorName}}: {{.Subject}}'")
+	flag.BoolVar(&l.oneline, "oneline", false, "shorthand for -pretty=oneline")
+	flag.StringVar(&l.sort, "sort", "history", "commit order: history, or impact to print commits with the largest geomean change first")
+	flag.BoolVar(&l.firstParent, "first-parent", false, "follow only the first parent of merge commits, like git log --first-parent")
+	flag.BoolVar(&l.allParents, "all-parents", false, "compare merge commits with each parent, not only the first one")
+	flag.IntVar(&l.interleave, "interleave", 0, "run test binaries of each commit and its first parent in alternation this many times and compare medians, to reduce drift. 0 to disable.")
+	flag.BoolVar(&l.dryRun, "dry-run", false, "print commits that would be evaluated, whether their results are cached, benchmarks that would run and the estimated runtime, without running anything")
+	flag.BoolVar(&l.dryRun, "n", false, "shorthand for -dry-run")
+	flag.BoolVar(&l.progress, "progress", true, "display progress and ETA on stderr: a status line if stderr is a terminal, otherwise a line every 30s. Defaults to false if the output is paged to the same terminal.")
+	flag.StringVar(&l.profile, "profile", "", "comma-separated kinds of profiles to collect for each benchmark at each commit in separate runs: cpu, mem or trace. Profiles are stored next to the cache, see `ggt pprof`.")
+	flag.BoolVar(&l.affecting, "affecting", false, "evaluate only commits that modify the packages, their dependencies in the repo, files they embed, go.mod/go.sum of their modules or go.work in the repo root. Dependencies are listed with -go/-goroot in the current working tree.")
+	addChangeFilterFlags(&l.filter)
+	addBuildSettingsFlags(&l.settings)
+	addToolchainFlags(&l.settings)
+	addMatrixFlags(&l.matrix)
 	args = parseFlags(args)
 
-	if l.nsPerOpThreshold < 0 || l.nsPerOpThreshold > 100 {
-		return fmt.Errorf("threshold must be in [0, 100] interval")
+	if err := l.filter.Validate(); err != nil {
+		return err
+	}
+	if l.sort != "history" && l.sort != "impact" {
+		return fmt.Errorf("-sort must be history or impact")
+	}
+	if l.oneline {
+		l.pretty = "oneline"
+	}
+	var err error
+	if l.formatter, err = newCommitFormatter(l.pretty); err != nil {
+		return err
+	}
+	if l.interleave < 0 {
+		return fmt.Errorf("-interleave must not be negative")
+	}
+	if l.profile != "" {
+		l.profileKinds = strings.Split(l.profile, ",")
+		if err := repo.ValidateProfileKinds(l.profileKinds); err != nil {
+			return err
+		}
+	}
+	if l.firstParent && l.allParents {
+		return fmt.Errorf("-first-parent and -all-parents are mutually exclusive")
+	}
+	if err := l.settings.Validate(); err != nil {
+		return err
+	}
+	if err := l.matrix.Validate(); err != nil {
+		return err
 	}
 
 	if len(args) > 0 && args[0] != "--" {
@@ -75,111 +124,221 @@ func (l *cmdLog) parseFlags(args []string) error {
 // cmdLog is `ggt log` command.
 //
 // Usage:
-//    ggt log [options] [revision range] [--] [packages]
+//
+//	ggt log [options] [revision range] [--] [packages]
+//
 // Options:
-//    -bench: same as -bench in `go test`
+//
+//	-bench: same as -bench in `go test`
+//	-testflag: a `go test` flag to pass through, e.g. -testflag=-benchtime=3s
+//	-env: an environment variable for `go test`, e.g. -env=GOGC=off
+//	-go, -goroot: the Go toolchain to run benchmarks with
+//	-cpu, -tagset, -envset: run each commit in several series
+//	-only, -threshold, -regression-threshold, -improvement-threshold, -min-delta, -new:
+//	    changes to display
+//	-hide-unchanged: do not print commits without displayed changes
+//	-affecting: skip commits that do not modify the packages or their dependencies
+//	-first-parent: follow only the first parent of merge commits
+//	-all-parents: compare merge commits with each parent
+//	-pretty, -oneline: commit header format
+//	-sort=impact: print commits with the largest geomean change first
+//	-interleave: alternate runs of each commit and its parent
+//	-n, -dry-run: print the plan without running benchmarks
+//	-progress: display progress on stderr
+//	-profile: collect profiles of benchmarks, e.g. -profile=cpu,mem
 func (l *cmdLog) run() error {
 	set, err := openPackageSet(l.packages)
 	if err != nil {
 		return err
 	}
-
-	logArgs := []string{"log", "--format=%H"}
-	if l.revisionRange != "" {
-		logArgs = append(logArgs, l.revisionRange)
-	}
-	gitLog := set.repo.git(logArgs...)
-	gitLogStdout, err := gitLog.StdoutPipe()
-	if err != nil {
+	if err := l.settings.ResolveToolchain(); err != nil {
 		return err
 	}
-	gitLogReader := bufio.NewReader(gitLogStdout)
-	logCmd(gitLog)
-	if err := gitLog.Start(); err != nil {
-		return fmt.Errorf("could not start git log: %s", err)
+	set.Settings = l.settings
+	series := l.matrix.Series(l.settings)
+	printer := &resultsPrinter{
+		set:         set,
+		series:      series,
+		show:        l.filter.Match,
+		significant: l.filter.Significant,
 	}
-	defer gitLog.Process.Kill()
 
-	commitId, err := gitLogReader.ReadString('\n')
-	if err == io.EOF {
-		return nil
+	var logArgs []string
+	if l.firstParent {
+		logArgs = append(logArgs, "--first-parent")
+	}
+	if l.revisionRange != "" {
+		logArgs = append(logArgs, l.revisionRange)
 	}
+	if l.affecting {
+		// Each listed commit is compared with its nearest listed ancestor,
+		// which has the same packages and dependencies as skipped commits in between.
+		pathspecs, err := set.DependencyPathspecs()
+		if err != nil {
+			return err
+		}
+		logArgs = append(logArgs, "--")
+		logArgs = append(logArgs, pathspecs...)
+	}
+	commits, err := history.Read(&set.Repo, logArgs...)
 	if err != nil {
 		return err
 	}
-	commitId = strings.TrimSuffix(commitId, "\n")
-
-	// in each iteration, prevParentRun is test run results of parent of commit processed in prev iteration
-	var prevParentRun *commitTestRun
-	first := true
-	for {
-		parentCommitId, err := gitLogReader.ReadString('\n')
-		if err != nil && err != io.EOF {
+	if l.dryRun {
+		return l.printPlan(set, series, commits.Commits)
+	}
+	if l.progress && (stopPager == nil || !stderrIsTerminal || flagIsSet("progress")) {
+		plans, err := planCommits(set, l.benchRegex, series, commits.Commits)
+		if err != nil {
 			return err
 		}
-		parentCommitId = strings.TrimSuffix(parentCommitId, "\n")
+		l.prog = newProgress(os.Stderr, stderrIsTerminal, set, plans)
+		defer l.prog.Stop()
+		set.Progress = l.prog.packageProgress
+		defer redirectStderr(l.prog.Writer)()
+	}
 
-		// Print the commit.
-		if first {
-			first = false
-		} else {
-			fmt.Println()
+	// runs memoizes results of commits that are not processed yet.
+	runs := map[string]*bench.Results{}
+	getRun := func(commitId string) (*bench.Results, error) {
+		if run, ok := runs[commitId]; ok {
+			return run, nil
 		}
-		printCommit := set.repo.git("log", "-1", commitId)
-		printCommit.Stdout = os.Stdout
-		logCmd(printCommit)
-		if err = printCommit.Run(); err != nil {
-			return err
+		l.prog.startCommit(commitId)
+		run, err := set.GetSeriesBenchmarks(commitId, l.benchRegex, series)
+		if err != nil {
+			return nil, err
 		}
-		fmt.Println()
-
-		var parentRun *commitTestRun // test results of parent of current commit.
-		if parentCommitId != "" {
-			benchmarks, err := set.GetBenchmarks(parentCommitId, l.benchRegex, nil)
-			if err != nil {
-				if err, ok := err.(*TestFailedError); ok {
-					parentRun = &commitTestRun{failed: err}
-				}
-				return err
-			} else {
-				parentRun = &commitTestRun{benchmarks: benchmarks}
+		if len(l.profileKinds) > 0 {
+			if err := set.ProfileBenchmarks(commitId, series, run, l.profileKinds); err != nil {
+				return nil, err
 			}
 		}
+		l.prog.finishCommit(commitId)
+		runs[commitId] = run
+		return run, nil
+	}
 
-		for _, p := range set.relPackagePaths {
-			printBenchmark := func(b *benchmarkRun) {
-				if parentRun != nil {
-					l.annotate(parentRun, b, p)
-					if float64(b.NsPerOpChange) < l.nsPerOpThreshold {
-						return
-					}
-				}
-				fmt.Println(b)
+	printDeltaLegend(os.Stdout)
+	var outputs []*commitOutput // buffered outputs if sorted by impact
+	printedCommits := 0
+	for _, commit := range commits.Commits {
+		commitId := commit.Id
+		run, err := getRun(commitId)
+		if err != nil {
+			return err
+		}
+		delete(runs, commitId)
+
+		// Output of each commit is buffered, so it can be skipped with -hide-unchanged.
+		out := &commitOutput{commit: commit}
+		printer.w = &out.body
+		printed := 0
+		if run.AllFailed() {
+			printed = printer.PrintFailures(run)
+		} else {
+			parents := commit.Parents
+			if len(parents) > 1 && !l.allParents {
+				parents = parents[:1]
+			}
+			if len(parents) == 0 {
+				printed, _ = printer.Print(run, nil)
 			}
-			if prevParentRun != nil {
-				// the commit we are processing in this iteration is parent of th commit
-				// processed in the prev iteration. Thus prevParentRun contains results for
-				// the commit we are processing in this iteration.
-				for _, bs := range prevParentRun.benchmarks {
-					for _, b := range bs {
-						printBenchmark(&b)
+			for i, parentId := range parents {
+				if len(parents) > 1 {
+					fmt.Fprintf(&out.body, "relative to parent %s:\n", history.ShortId(parentId))
+				}
+				// Load ancestors up to the nearest one without failures.
+				ancestorIds := commits.FirstParentChain(parentId)
+				var ancestors []*bench.Results
+				for _, ancestorId := range ancestorIds {
+					ancestor, err := getRun(ancestorId)
+					if err != nil {
+						return err
+					}
+					ancestors = append(ancestors, ancestor)
+					if !ancestor.HasFailures() {
+						break
 					}
 				}
-			} else {
-				if _, err := set.GetBenchmarks(commitId, l.benchRegex, printBenchmark); err != nil {
-					if _, ok := err.(*TestFailedError); !ok {
+				current := run
+				if i == 0 && len(ancestors) > 0 {
+					// Interleaved samples are compared only with samples of the parent
+					// from the same interleaving; cached results stay as they are.
+					parentView, view, err := set.Interleave(parentId, commitId, series, l.interleave, ancestors[0], run)
+					if err != nil {
 						return err
 					}
+					ancestors[0], current = parentView, view
+				}
+				n, summary := printer.Print(current, history.NearestAncestorBaseline(ancestorIds, ancestors))
+				printed += n
+				if i == 0 {
+					out.impact = math.Abs(summary.Geomean())
 				}
 			}
 		}
+		if printed == 0 && l.hideUnchanged {
+			continue
+		}
 
-		if parentCommitId == "" {
-			// git log has completed.
-			break
+		if l.sort == "impact" {
+			outputs = append(outputs, out)
+			continue
+		}
+		if err := l.printCommitOutput(out, printedCommits == 0); err != nil {
+			return err
+		}
+		printedCommits++
+	}
+
+	sort.Stable(byImpact(outputs))
+	for i, out := range outputs {
+		if err := l.printCommitOutput(out, i == 0); err != nil {
+			return err
 		}
-		commitId = parentCommitId
-		prevParentRun = parentRun
 	}
 	return nil
 }
+
+// commitOutput is buffered output of a commit, printed after its header.
+type commitOutput struct {
+	commit *history.Commit
+	body   bytes.Buffer
+	impact float64 // absolute geomean change relative to the first parent, in percents
+}
+
+// byImpact sorts commit outputs by impact, the largest first.
+type byImpact []*commitOutput
+
+func (s byImpact) Len() int           { return len(s) }
+func (s byImpact) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byImpact) Less(i, j int) bool { return s[i].impact > s[j].impact }
+
+// printCommitOutput prints the commit header followed by out.body.
+// first is true if this is the first printed commit.
+func (l *cmdLog) printCommitOutput(out *commitOutput, first bool) error {
+	header, err := l.formatter.Format(out.commit)
+	if err != nil {
+		return err
+	}
+	// One-line headers are printed without blank lines.
+	compact := !strings.Contains(strings.TrimSuffix(header, "\n"), "\n")
+	var buf bytes.Buffer
+	if !first && !compact {
+		fmt.Fprintln(&buf)
+	}
+	fmt.Fprintln(&buf, strings.TrimSuffix(header, "\n"))
+	if !compact {
+		fmt.Fprintln(&buf)
+	}
+	buf.ReadFrom(&out.body)
+
+	var stdout io.Writer = os.Stdout
+	if l.prog != nil {
+		// stdout may be the terminal of the status line.
+		stdout = l.prog.Writer(stdout)
+	}
+	_, err = buf.WriteTo(stdout)
+	return err
+}
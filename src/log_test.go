@@ -0,0 +1,147 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nodirt/ggt/internal/fixture"
+)
+
+// logFixture creates a fixture repo with commits that change,
+// fail to build and fail benchmarks, and returns it and its commit ids,
+// oldest first.
+func logFixture(t *testing.T) (*fixture.Repo, []string) {
+	r := fixture.New(t)
+	var commits []string
+	commit := func(message string, output ...string) {
+		r.Package(".", output...)
+		commits = append(commits, r.Commit(message))
+	}
+	commit("first", "BenchmarkA 100 100 ns/op", "BenchmarkB 100 200 ns/op")
+	commit("slower", "BenchmarkA 100 150 ns/op", "BenchmarkB 100 200 ns/op")
+	commit("broken",
+		"stderr: # example.com/foo",
+		"stderr: p.go:1: undefined: x",
+		"FAIL\texample.com/foo [build failed]",
+		"exit 2")
+	commit("fixed", "BenchmarkA 100 150 ns/op", "BenchmarkB 100 100 ns/op")
+	commit("failing",
+		"BenchmarkA 100 150 ns/op",
+		"--- FAIL: BenchmarkB",
+		"    b_test.go:10: oops",
+		"FAIL",
+		"exit 1")
+	return r, commits
+}
+
+func TestLog(t *testing.T) {
+	r, commits := logFixture(t)
+	want := strings.Join([]string{
+		"delta: change of time/op relative to the baseline, + is slower, - is faster, old → new",
+		"",
+		"failing",
+		"test failed",
+		"    --- FAIL: BenchmarkB",
+		"        b_test.go:10: oops",
+		"    FAIL",
+		"fixed",
+		// "broken" failed, so "fixed" is compared with "slower".
+		"BenchmarkB  100  100ns/op  -50.0%  200ns → 100ns  (vs " + commits[1][:7] + ")",
+		"summary: geomean -29.3%, 0 regressions, 1 improvement, 2 benchmarks",
+		"broken",
+		"build failed",
+		"    # example.com/foo",
+		"    p.go:1: undefined: x",
+		"slower",
+		"BenchmarkA  100  150ns/op  +50.0%  100ns → 150ns",
+		"summary: geomean +22.5%, 1 regression, 0 improvements, 2 benchmarks",
+		"first",
+		"BenchmarkA  100  100ns/op",
+		"BenchmarkB  100  200ns/op",
+		"",
+	}, "\n")
+
+	out, err := runCommand(t, &cmdLog{}, "-pretty={{.Subject}}", "HEAD", fixture.ImportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != want {
+		t.Errorf("output:\n%s\nwant:\n%s", out, want)
+	}
+	runs := len(r.GoTestRuns())
+
+	// The second run loads all results and failures from the cache.
+	out, err = runCommand(t, &cmdLog{}, "-pretty={{.Subject}}", "HEAD", fixture.ImportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != want {
+		t.Errorf("cached output:\n%s\nwant:\n%s", out, want)
+	}
+	if got := r.GoTestRuns()[runs:]; len(got) != 0 {
+		t.Errorf("unexpected go test runs with cache: %q", got)
+	}
+
+	// Without the cache, benchmarks run again.
+	if _, err := runCommand(t, &cmdLog{}, "-caching=false", "-pretty={{.Subject}}", "HEAD", fixture.ImportPath); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(r.GoTestRuns()) - runs; got != len(commits) {
+		t.Errorf("go test ran %d times without cache, want %d", got, len(commits))
+	}
+}
+
+func TestLogHideUnchanged(t *testing.T) {
+	_, commits := logFixture(t)
+	out, err := runCommand(t, &cmdLog{}, "-oneline", "-hide-unchanged", "-only=regressions", commits[3], fixture.ImportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"delta: change of time/op relative to the baseline, + is slower, - is faster, old → new",
+		"",
+		commits[2][:7] + " broken",
+		"build failed",
+		"    # example.com/foo",
+		"    p.go:1: undefined: x",
+		commits[1][:7] + " slower",
+		"BenchmarkA  100  150ns/op  +50.0%  100ns → 150ns",
+		"summary: geomean +22.5%, 1 regression, 0 improvements, 2 benchmarks",
+		// The root commit has no baseline, so it has no regressions.
+		"",
+	}, "\n")
+	if out != want {
+		t.Errorf("output:\n%s\nwant:\n%s", out, want)
+	}
+
+	// With -new=false, benchmarks without a baseline are hidden even with -only=all.
+	out, err = runCommand(t, &cmdLog{}, "-pretty={{.Subject}}", "-hide-unchanged", "-new=false", commits[0], fixture.ImportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "delta: change of time/op relative to the baseline, + is slower, - is faster, old → new\n\n"; out != want {
+		t.Errorf("output with -new=false:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestLogThroughput(t *testing.T) {
+	r := fixture.New(t)
+	r.Package(".", "BenchmarkA 100 100 ns/op 10.00 MB/s", "BenchmarkB 100 200 ns/op")
+	r.Commit("first")
+
+	want := strings.Join([]string{
+		"delta: change of time/op relative to the baseline, + is slower, - is faster, old → new",
+		"",
+		"first",
+		"BenchmarkA  100  100ns/op  10.00 MB/s",
+		"BenchmarkB  100  200ns/op",
+		"",
+	}, "\n")
+	out, err := runCommand(t, &cmdLog{}, "-pretty={{.Subject}}", "HEAD", fixture.ImportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != want {
+		t.Errorf("output:\n%s\nwant:\n%s", out, want)
+	}
+}
@@ -5,7 +5,11 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+
+	"github.com/nodirt/ggt/repo"
 )
 
 type command interface {
@@ -17,7 +21,14 @@ type command interface {
 }
 
 var commands = map[string]command {
-	"cmd": &cmdLog{},
+	"blame":      &cmdBlame{},
+	"cache":      &cmdCache{},
+	"cmd":        &cmdLog{},
+	"compare":    &cmdCompare{},
+	"detect":     &cmdDetect{},
+	"explain":    &cmdExplain{},
+	"pprof":      &cmdPprof{},
+	"toolchains": &cmdToolchains{},
 }
 
 func usage() {
@@ -62,12 +73,47 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err := cmd.run(); err != nil {
+	if _, ok := cmd.(pagedCommand); ok {
+		startPager()
+	}
+	handleSignals()
+	err := cmd.run()
+	if stopPager != nil {
+		stopPager()
+	}
+	if pagerQuit {
+		// Nobody reads the output, so there is nothing to report.
+		return
+	}
+	if err != nil && repo.Interrupted() {
+		fatal("interrupted; completed results are cached, run the same command to resume")
+	}
+	if err != nil {
 		fatal(err)
 	}
 }
 
+// handleSignals interrupts commands on SIGINT or SIGTERM, see repo.Interrupt,
+// so that the command returns after deleting its checkouts.
+// A second signal deletes the checkouts and exits immediately.
+func handleSignals() {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		fmt.Fprintln(repo.Stderr, "interrupting, press Ctrl-C again to exit immediately")
+		repo.Interrupt()
+		<-signals
+		repo.Kill()
+		repo.CloseSandboxes()
+		os.Exit(130)
+	}()
+}
+
 func fatal(a ...interface{}) {
+	if stopPager != nil {
+		stopPager()
+	}
 	msg := fmt.Sprint(a...)
 	if colored {
 		msg = red(msg)
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/nodirt/ggt/internal/fixture"
+)
+
+func TestMain(m *testing.M) {
+	fixture.Main(m)
+}
+
+// runCommand parses args and runs cmd like main does, and returns its stdout.
+// Flags are registered on a fresh flag set, so commands can run more than once.
+func runCommand(t *testing.T, cmd command, args ...string) (string, error) {
+	t.Helper()
+	flag.CommandLine = flag.NewFlagSet(cmd.name(), flag.ContinueOnError)
+	addGlobalFlags()
+	if err := cmd.parseFlags(args); err != nil {
+		t.Fatalf("%s %s: %s", cmd.name(), args, err)
+	}
+
+	f, err := ioutil.TempFile("", "ggt-stdout-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	stdout := os.Stdout
+	os.Stdout = f
+	runErr := cmd.run()
+	os.Stdout = stdout
+
+	out, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out), runErr
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/nodirt/ggt/repo"
+)
+
+// pagedCommand is a command whose output is piped to a pager.
+type pagedCommand interface {
+	command
+	paged()
+}
+
+// pagerCommand returns the pager command line, like git does:
+// $GGT_PAGER, $PAGER, core.pager git config or "less".
+// Returns "" if output should not be paged.
+func pagerCommand() string {
+	if pager, ok := os.LookupEnv("GGT_PAGER"); ok {
+		return pager
+	}
+	if pager, ok := os.LookupEnv("PAGER"); ok {
+		return pager
+	}
+	if pager, err := repo.Output(&repo.Command{Path: "git", Args: []string{"config", "core.pager"}, ReadOnly: true}); err == nil && pager != "" {
+		return pager
+	}
+	return "less"
+}
+
+// stopPager waits for the pager started by startPager. Nil if there is no pager.
+var stopPager func()
+
+// pagerQuit is true if the user quit the pager before the command finished.
+// Valid after stopPager returns.
+var pagerQuit bool
+
+// startPager starts a pager and redirects os.Stdout to it,
+// if stdout is a terminal and the pager is not disabled.
+// Call stopPager to flush the output and wait for the pager to exit.
+func startPager() {
+	if noPager || !stdoutIsTerminal {
+		return
+	}
+	pagerCmd := pagerCommand()
+	if pagerCmd == "" || pagerCmd == "cat" {
+		return
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		verbose.Printf("could not start pager: %s\n", err)
+		return
+	}
+	pager := exec.Command("sh", "-c", pagerCmd)
+	pager.Stdin = r
+	pager.Stdout = os.Stdout
+	pager.Stderr = os.Stderr
+	pager.Env = os.Environ()
+	if _, ok := os.LookupEnv("LESS"); !ok {
+		// quit if one screen, pass colors, do not clear the screen.
+		pager.Env = append(pager.Env, "LESS=FRX")
+	}
+	if _, ok := os.LookupEnv("LV"); !ok {
+		pager.Env = append(pager.Env, "LV=-c")
+	}
+	// The pager is interactive, so it is not run with repo.CommandRunner.
+	verbose.Println("$ " + strings.Join(pager.Args, " "))
+	if err := pager.Start(); err != nil {
+		verbose.Printf("could not start pager %q: %s\n", pagerCmd, err)
+		r.Close()
+		w.Close()
+		return
+	}
+	r.Close()
+
+	// Writes to the pipe fail silently after the pager exits, so the command
+	// would keep running benchmarks for output nobody reads.
+	stopped := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		pager.Wait()
+		select {
+		case <-stopped:
+		default:
+			verbose.Println("the pager exited, interrupting")
+			pagerQuit = true
+			repo.Interrupt()
+		}
+		close(exited)
+	}()
+
+	stdout := os.Stdout
+	os.Stdout = w
+	stopPager = func() {
+		close(stopped)
+		os.Stdout = stdout
+		w.Close()
+		<-exited
+		stopPager = nil
+	}
+}
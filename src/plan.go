@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nodirt/ggt/bench"
+	"github.com/nodirt/ggt/history"
+	"github.com/nodirt/ggt/repo"
+)
+
+// commitPlan is what `ggt log` would do at a commit.
+type commitPlan struct {
+	commit *history.Commit
+	plans  [][]*repo.Plan // [series][package]
+}
+
+// planKey identifies a package of a series.
+type planKey struct {
+	series int
+	pkg    int
+}
+
+// durationEstimator estimates durations of builds and benchmark runs
+// from durations cached at other commits.
+type durationEstimator struct {
+	builds     map[planKey][]time.Duration
+	benchmarks map[planKey]map[string][]time.Duration
+}
+
+func newDurationEstimator(commits []*commitPlan) *durationEstimator {
+	e := &durationEstimator{
+		builds:     map[planKey][]time.Duration{},
+		benchmarks: map[planKey]map[string][]time.Duration{},
+	}
+	for _, c := range commits {
+		for s, plans := range c.plans {
+			for pkg, p := range plans {
+				key := planKey{s, pkg}
+				if p.BuildDuration > 0 {
+					e.builds[key] = append(e.builds[key], p.BuildDuration)
+				}
+				if e.benchmarks[key] == nil {
+					e.benchmarks[key] = map[string][]time.Duration{}
+				}
+				for _, b := range p.Cached {
+					// Names of benchmarks without durations are known too.
+					e.benchmarks[key][b.Name] = append(e.benchmarks[key][b.Name], b.Duration)
+				}
+				for _, name := range p.Run {
+					e.benchmarks[key][name] = append(e.benchmarks[key][name], 0)
+				}
+			}
+		}
+	}
+	return e
+}
+
+// medianDuration returns the median of non-zero durations, or 0 if there are none.
+func medianDuration(durations []time.Duration) time.Duration {
+	var values []float64
+	for _, d := range durations {
+		if d > 0 {
+			values = append(values, float64(d))
+		}
+	}
+	if len(values) == 0 {
+		return 0
+	}
+	return time.Duration(bench.Median(values))
+}
+
+// estimate returns benchmarks that p would run, as far as known,
+// and the estimated duration. known is false if a duration is unknown,
+// in which case it is not included.
+func (e *durationEstimator) estimate(key planKey, p *repo.Plan) (run []string, d time.Duration, known bool) {
+	if p.Complete() {
+		return nil, 0, true
+	}
+	run = append([]string(nil), p.Run...)
+	if !p.NamesKnown {
+		// Assume the package has the same benchmarks as other commits.
+		for name := range e.benchmarks[key] {
+			if p.Cached.Find(name) == nil && !containsString(run, name) {
+				run = append(run, name)
+			}
+		}
+		sort.Strings(run)
+	}
+
+	builds := 0
+	if p.ListNames {
+		builds++
+	}
+	if len(run) > 0 || !p.ListNames {
+		builds++
+	}
+	known = true
+	build := p.BuildDuration
+	if build == 0 {
+		build = medianDuration(e.builds[key])
+	}
+	if build == 0 {
+		known = false
+	}
+	d = time.Duration(builds) * build
+	for _, name := range run {
+		runDuration := medianDuration(e.benchmarks[key][name])
+		if runDuration == 0 {
+			known = false
+		}
+		d += runDuration
+	}
+	return run, d, known
+}
+
+// commitEstimate returns the estimated duration of evaluating c.
+// runs is false if all results of c are cached.
+func (e *durationEstimator) commitEstimate(c *commitPlan) (d time.Duration, known, runs bool) {
+	known = true
+	for s, plans := range c.plans {
+		for pkg, p := range plans {
+			if p.Complete() {
+				continue
+			}
+			_, pd, pknown := e.estimate(planKey{s, pkg}, p)
+			d += pd
+			known = known && pknown
+			runs = true
+		}
+	}
+	return d, known, runs
+}
+
+// planCommits returns what `ggt log` would do at each of commits.
+func planCommits(set *repo.PackageSet, benchRegex string, series []bench.Series, commits []*history.Commit) ([]*commitPlan, error) {
+	var plans []*commitPlan
+	for _, commit := range commits {
+		p, err := set.PlanSeries(commit.Id, benchRegex, series)
+		if err != nil {
+			return nil, err
+		}
+		plans = append(plans, &commitPlan{commit, p})
+	}
+	return plans, nil
+}
+
+// formatEstimate formats an estimated duration.
+// If some durations are unknown, d is a lower bound.
+func formatEstimate(d time.Duration, known bool) string {
+	switch {
+	case d == 0 && !known:
+		return "unknown"
+	case !known:
+		return "at least " + formatDuration(d)
+	default:
+		return formatDuration(d)
+	}
+}
+
+// printPlan prints commits that would be evaluated, whether their results
+// are cached, benchmarks that would run and the estimated runtime.
+func (l *cmdLog) printPlan(set *repo.PackageSet, series []bench.Series, commits []*history.Commit) error {
+	plans, err := planCommits(set, l.benchRegex, series, commits)
+	if err != nil {
+		return err
+	}
+	e := newDurationEstimator(plans)
+
+	toRun := 0
+	var total time.Duration
+	totalKnown := true
+	for i, c := range plans {
+		d, known, runs := e.commitEstimate(c)
+		if runs {
+			toRun++
+			total += d
+			totalKnown = totalKnown && known
+		}
+
+		var lines []string
+		for s, seriesPlans := range c.plans {
+			for pkg, p := range seriesPlans {
+				var prefix []string
+				if len(series) > 1 {
+					prefix = append(prefix, series[s].Name)
+				}
+				if len(set.RelPackagePaths) > 1 {
+					prefix = append(prefix, p.RelPackagePath)
+				}
+				line := ""
+				if len(prefix) > 0 {
+					line = strings.Join(prefix, " ") + ": "
+				}
+
+				run, d, known := e.estimate(planKey{s, pkg}, p)
+				switch {
+				case p.Failure != nil:
+					line += "cached " + p.Failure.Error()
+				case p.Complete():
+					line += fmt.Sprintf("cached %s", pluralize(len(p.Cached), "benchmark"))
+				default:
+					var parts []string
+					if len(p.Cached) > 0 {
+						parts = append(parts, fmt.Sprintf("cached %s", pluralize(len(p.Cached), "benchmark")))
+					}
+					if p.ListNames {
+						parts = append(parts, "list benchmarks")
+					}
+					switch {
+					case len(run) == 0 && p.ListNames:
+						parts = append(parts, "run missing ones")
+					case len(run) == 0 && !p.NamesKnown:
+						parts = append(parts, "run benchmarks matching -bench")
+					case len(run) > 0 && !p.NamesKnown:
+						parts = append(parts, "run "+strings.Join(run, " ")+" and possibly others")
+					case len(run) > 0:
+						parts = append(parts, "run "+strings.Join(run, " "))
+					}
+					line += strings.Join(parts, ", ") + "; estimated " + formatEstimate(d, known)
+				}
+				lines = append(lines, line)
+			}
+		}
+		out := &commitOutput{commit: c.commit}
+		for _, line := range lines {
+			fmt.Fprintln(&out.body, line)
+		}
+		if err := l.printCommitOutput(out, i == 0); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println()
+	fmt.Printf("plan: %s, %d to run, estimated runtime %s\n",
+		pluralize(len(commits), "commit"), toRun, formatEstimate(total, totalKnown))
+	if l.interleave > 0 {
+		fmt.Println("interleaved runs are not included in the estimate")
+	}
+	return nil
+}
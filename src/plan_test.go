@@ -0,0 +1,93 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/nodirt/ggt/internal/fixture"
+)
+
+// estimateRegex matches estimated durations, which depend on the machine.
+var estimateRegex = regexp.MustCompile(`estimated (runtime )?(at least )?[0-9.]+m?s`)
+
+func TestLogDryRun(t *testing.T) {
+	r, commits := logFixture(t)
+	dryRun := func() string {
+		t.Helper()
+		runs := len(r.GoTestRuns())
+		out, err := runCommand(t, &cmdLog{}, "-n", "-pretty={{.Subject}}", "HEAD", fixture.ImportPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.GoTestRuns()[runs:]; len(got) != 0 {
+			t.Errorf("dry run ran go test: %q", got)
+		}
+		return estimateRegex.ReplaceAllString(out, "estimated ${1}X")
+	}
+
+	want := strings.Join([]string{
+		"failing",
+		"run benchmarks matching -bench; estimated unknown",
+		"fixed",
+		"run benchmarks matching -bench; estimated unknown",
+		"broken",
+		"run benchmarks matching -bench; estimated unknown",
+		"slower",
+		"run benchmarks matching -bench; estimated unknown",
+		"first",
+		"run benchmarks matching -bench; estimated unknown",
+		"",
+		"plan: 5 commits, 5 to run, estimated runtime unknown",
+		"",
+	}, "\n")
+	if out := dryRun(); out != want {
+		t.Errorf("output without cache:\n%s\nwant:\n%s", out, want)
+	}
+
+	// Run BenchmarkA of the two middle commits.
+	if _, err := runCommand(t, &cmdLog{}, "-bench=A$", commits[1]+".."+commits[3], fixture.ImportPath); err != nil {
+		t.Fatal(err)
+	}
+	want = strings.Join([]string{
+		"failing",
+		"run BenchmarkA and possibly others; estimated X",
+		"fixed",
+		"cached 1 benchmark, list benchmarks, run missing ones; estimated X",
+		"broken",
+		"cached build failed",
+		"slower",
+		"run BenchmarkA and possibly others; estimated X",
+		"first",
+		"run BenchmarkA and possibly others; estimated X",
+		"",
+		"plan: 5 commits, 4 to run, estimated runtime X",
+		"",
+	}, "\n")
+	if out := dryRun(); out != want {
+		t.Errorf("output with cache:\n%s\nwant:\n%s", out, want)
+	}
+
+	// After a full run, everything is cached.
+	if _, err := runCommand(t, &cmdLog{}, "HEAD", fixture.ImportPath); err != nil {
+		t.Fatal(err)
+	}
+	want = strings.Join([]string{
+		"failing",
+		"cached test failed",
+		"fixed",
+		"cached 2 benchmarks",
+		"broken",
+		"cached build failed",
+		"slower",
+		"cached 2 benchmarks",
+		"first",
+		"cached 2 benchmarks",
+		"",
+		"plan: 5 commits, 0 to run, estimated runtime X",
+		"",
+	}, "\n")
+	if out := dryRun(); out != want {
+		t.Errorf("output with full cache:\n%s\nwant:\n%s", out, want)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/nodirt/ggt/bench"
+)
+
+// cmdPprof is `ggt pprof` command.
+// It profiles a benchmark at two revisions and opens a pprof diff of them.
+type cmdPprof struct {
+	packages    []string
+	benchRegex  string         // must match one benchmark
+	oldRevision string         // baseline of the diff
+	newRevision string         // revision to compare with oldRevision
+	kind        string         // kind of profiles: cpu or mem
+	pprofFlags  stringList     // passed to `go tool pprof`
+	settings    bench.Settings // passed to every `go test` run
+}
+
+func (*cmdPprof) name() string {
+	return "pprof"
+}
+
+func (*cmdPprof) shortDescription() string {
+	return "open a pprof diff of a benchmark between two revisions"
+}
+
+func (*cmdPprof) usage() {
+	fmt.Println("usage: ggt pprof [options] -bench=<regex> <old> <new> [--] [packages]")
+	fmt.Println()
+	fmt.Println("Profiles are stored next to the cache and reused, see -profile in `ggt log`.")
+	fmt.Println()
+	fmt.Println("Options:")
+	flag.PrintDefaults()
+}
+
+func (c *cmdPprof) parseFlags(args []string) error {
+	flag.StringVar(&c.benchRegex, "bench", "", "regex that matches the benchmark to profile. Must match one benchmark.")
+	flag.StringVar(&c.kind, "kind", "cpu", "kind of profiles to compare: cpu or mem")
+	flag.Var(&c.pprofFlags, "pprofflag", "go tool pprof flag, e.g. -pprofflag=-http=:8080 or -pprofflag=-top. May be repeated.")
+	addBuildSettingsFlags(&c.settings)
+	addToolchainFlags(&c.settings)
+	args = parseFlags(args)
+
+	if c.benchRegex == "" {
+		return fmt.Errorf("-bench is required")
+	}
+	if c.kind != "cpu" && c.kind != "mem" {
+		return fmt.Errorf("-kind must be cpu or mem")
+	}
+	if err := c.settings.Validate(); err != nil {
+		return err
+	}
+
+	if len(args) < 2 || args[0] == "--" || args[1] == "--" {
+		return fmt.Errorf("old and new revisions are not specified")
+	}
+	c.oldRevision, c.newRevision = args[0], args[1]
+	args = args[2:]
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	c.packages = args
+	if len(c.packages) == 0 {
+		return fmt.Errorf("packages are not specified")
+	}
+	return nil
+}
+
+func (c *cmdPprof) run() error {
+	set, err := openPackageSet(c.packages)
+	if err != nil {
+		return err
+	}
+	if err := c.settings.ResolveToolchain(); err != nil {
+		return err
+	}
+	set.Settings = c.settings
+
+	// The benchmark is resolved at the new revision and must exist at the old one.
+	name, newProfiles, err := set.ProfileBenchmark(c.newRevision, c.benchRegex, []string{c.kind})
+	if err != nil {
+		return err
+	}
+	_, oldProfiles, err := set.ProfileBenchmark(c.oldRevision, "^"+regexp.QuoteMeta(name)+"$", []string{c.kind})
+	if err != nil {
+		return err
+	}
+
+	args := append([]string{"tool", "pprof", "-diff_base=" + oldProfiles[c.kind]}, c.pprofFlags...)
+	args = append(args, newProfiles[c.kind])
+	// pprof is interactive, so it is not run with repo.CommandRunner.
+	pprof := exec.Command(c.settings.GoCommand(), args...)
+	pprof.Stdin = os.Stdin
+	pprof.Stdout = os.Stdout
+	pprof.Stderr = os.Stderr
+	if c.settings.GoRoot != "" {
+		pprof.Env = append(os.Environ(), "GOROOT="+c.settings.GoRoot)
+	}
+	fmt.Fprintf(os.Stderr, "%s %s profile at %s relative to %s\n", name, c.kind, c.newRevision, c.oldRevision)
+	verbose.Println("$ " + strings.Join(pprof.Args, " "))
+	return pprof.Run()
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/nodirt/ggt/history"
+)
+
+// prettyFormats are templates of commit headers, named like git's pretty formats.
+var prettyFormats = map[string]string{
+	"oneline": `{{yellow .ShortId}} {{.Subject}}`,
+	"short": `{{yellow (print "commit " .Id)}}
+{{merge .}}Author: {{.AuthorName}} <{{.AuthorEmail}}>
+
+{{indent .Subject}}
+`,
+	"medium": `{{yellow (print "commit " .Id)}}
+{{merge .}}Author: {{.AuthorName}} <{{.AuthorEmail}}>
+Date:   {{.AuthorDate}}
+
+{{indent .Message}}
+`,
+	"full": `{{yellow (print "commit " .Id)}}
+{{merge .}}Author: {{.AuthorName}} <{{.AuthorEmail}}>
+Commit: {{.CommitterName}} <{{.CommitterEmail}}>
+
+{{indent .Message}}
+`,
+}
+
+// commitFormatter formats commit headers.
+type commitFormatter struct {
+	tmpl *template.Template
+}
+
+// newCommitFormatter creates a formatter from a name of a pretty format
+// or a text/template over history.Commit fields, e.g. "{{.ShortId}} {{.AuthorName}}".
+func newCommitFormatter(pretty string) (*commitFormatter, error) {
+	text, ok := prettyFormats[pretty]
+	if !ok {
+		if !strings.Contains(pretty, "{{") {
+			return nil, fmt.Errorf("unknown pretty format %q", pretty)
+		}
+		text = pretty
+	}
+	funcs := template.FuncMap{
+		"yellow": func(s string) string {
+			if colored {
+				return yellow(s)
+			}
+			return s
+		},
+		"indent": func(s string) string {
+			lines := strings.Split(s, "\n")
+			for i, line := range lines {
+				if line != "" {
+					lines[i] = "    " + line
+				}
+			}
+			return strings.Join(lines, "\n")
+		},
+		"merge": func(c *history.Commit) string {
+			if len(c.Parents) < 2 {
+				return ""
+			}
+			short := make([]string, len(c.Parents))
+			for i, p := range c.Parents {
+				short[i] = history.ShortId(p)
+			}
+			return "Merge: " + strings.Join(short, " ") + "\n"
+		},
+	}
+	tmpl, err := template.New("commit").Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid commit format: %s", err)
+	}
+	return &commitFormatter{tmpl}, nil
+}
+
+// Format returns the header of c.
+func (f *commitFormatter) Format(c *history.Commit) (string, error) {
+	var buf bytes.Buffer
+	if err := f.tmpl.Execute(&buf, c); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
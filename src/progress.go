@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nodirt/ggt/bench"
+	"github.com/nodirt/ggt/history"
+	"github.com/nodirt/ggt/repo"
+)
+
+const (
+	// progressInterval is how often progress is printed if stderr is not a terminal.
+	progressInterval = 30 * time.Second
+	// statusInterval is how often the status line is redrawn on a terminal.
+	statusInterval = time.Second
+)
+
+// progress displays progress of `ggt log` on stderr: a status line that
+// is redrawn in place if stderr is a terminal, otherwise a line every
+// progressInterval.
+// Methods of a nil *progress do nothing.
+type progress struct {
+	mu  sync.Mutex
+	w   io.Writer
+	tty bool
+
+	start       time.Time
+	commits     []*commitPlan
+	estimates   []commitEstimate
+	done        map[string]bool // ids of evaluated commits
+	actual      []time.Duration // durations of evaluated commits that ran benchmarks
+	multiPkg    bool            // true to print the package
+	current     int             // index of the commit being evaluated, -1 if none
+	commitStart time.Time
+	ran         bool   // true if the current commit ran benchmarks
+	pkg         string // package being run
+	benchmark   string // last benchmark result
+
+	shown bool // true if the status line is on the screen
+	stop  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// commitEstimate is an estimated duration of evaluating a commit.
+type commitEstimate struct {
+	d     time.Duration
+	known bool
+	runs  bool
+}
+
+// newProgress starts displaying progress of evaluating commits to w.
+// tty is true if w is a terminal. Call stop when done.
+func newProgress(w io.Writer, tty bool, set *repo.PackageSet, commits []*commitPlan) *progress {
+	p := &progress{
+		w:        w,
+		tty:      tty,
+		start:    time.Now(),
+		commits:  commits,
+		done:     map[string]bool{},
+		multiPkg: len(set.RelPackagePaths) > 1,
+		current:  -1,
+		stop:     make(chan struct{}),
+	}
+	e := newDurationEstimator(commits)
+	for _, c := range commits {
+		d, known, runs := e.commitEstimate(c)
+		p.estimates = append(p.estimates, commitEstimate{d, known, runs})
+	}
+
+	interval := progressInterval
+	if tty {
+		interval = statusInterval
+	}
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				p.mu.Lock()
+				if p.tty {
+					p.draw()
+				} else {
+					fmt.Fprintln(p.w, "progress: "+p.status())
+				}
+				p.mu.Unlock()
+			}
+		}
+	}()
+	return p
+}
+
+// startCommit is called before benchmarks of a commit are evaluated.
+func (p *progress) startCommit(commitId string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.current = -1
+	for i, c := range p.commits {
+		if c.commit.Id == commitId {
+			p.current = i
+		}
+	}
+	p.commitStart = time.Now()
+	p.ran = false
+	p.pkg = ""
+	p.benchmark = ""
+	p.draw()
+}
+
+// finishCommit is called after benchmarks of a commit are evaluated.
+func (p *progress) finishCommit(commitId string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done[commitId] = true
+	if p.ran {
+		p.actual = append(p.actual, time.Since(p.commitStart))
+	}
+	p.current = -1
+	p.pkg = ""
+	p.benchmark = ""
+	p.draw()
+}
+
+// packageProgress implements repo.PackageSet.Progress.
+func (p *progress) packageProgress(pkg *repo.PackageSnapshot, benchmark *bench.Run) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ran = true
+	p.pkg = pkg.RelPackagePath
+	p.benchmark = ""
+	if benchmark != nil {
+		p.benchmark = benchmark.Name
+	}
+	p.draw()
+}
+
+// eta returns the estimated time to evaluate the remaining commits.
+// Commits without estimates are assumed to take as long as evaluated ones
+// on average. Returns false if the time cannot be estimated.
+func (p *progress) eta() (time.Duration, bool) {
+	var avg time.Duration
+	for _, d := range p.actual {
+		avg += d
+	}
+	if len(p.actual) > 0 {
+		avg /= time.Duration(len(p.actual))
+	}
+
+	var eta time.Duration
+	for i, c := range p.commits {
+		e := p.estimates[i]
+		if p.done[c.commit.Id] || !e.runs {
+			continue
+		}
+		d := e.d
+		if !e.known {
+			if avg == 0 {
+				return 0, false
+			}
+			if d < avg {
+				d = avg
+			}
+		}
+		if i == p.current {
+			if d -= time.Since(p.commitStart); d < 0 {
+				d = 0
+			}
+		}
+		eta += d
+	}
+	return eta, true
+}
+
+// status returns the progress as one line.
+func (p *progress) status() string {
+	parts := []string{fmt.Sprintf("[%d/%d]", len(p.done), len(p.commits))}
+	if p.current >= 0 {
+		parts[0] = fmt.Sprintf("[%d/%d]", len(p.done)+1, len(p.commits))
+		parts = append(parts, history.ShortId(p.commits[p.current].commit.Id))
+	}
+	if p.pkg != "" && p.multiPkg {
+		parts = append(parts, p.pkg)
+	}
+	if p.benchmark != "" {
+		parts = append(parts, p.benchmark)
+	}
+	status := strings.Join(parts, " ") + ", elapsed " + formatDuration(time.Since(p.start))
+	if eta, ok := p.eta(); ok {
+		status += ", ETA " + formatDuration(eta)
+	}
+	return status
+}
+
+// draw redraws the status line if w is a terminal.
+func (p *progress) draw() {
+	if !p.tty {
+		return
+	}
+	status := p.status()
+	if width := terminalWidth(); len(status) >= width {
+		status = status[:width-1]
+	}
+	fmt.Fprintf(p.w, "\r%s\033[K", status)
+	p.shown = true
+}
+
+// clear removes the status line from the screen.
+func (p *progress) clear() {
+	if p.shown {
+		fmt.Fprint(p.w, "\r\033[K")
+		p.shown = false
+	}
+}
+
+// Writer returns an io.Writer that writes to w without mixing the output
+// with the status line.
+func (p *progress) Writer(w io.Writer) io.Writer {
+	return writerFunc(func(data []byte) (int, error) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		shown := p.shown
+		p.clear()
+		n, err := w.Write(data)
+		// A partial line would be glued to the status line.
+		if shown && len(data) > 0 && data[len(data)-1] == '\n' {
+			p.draw()
+		}
+		return n, err
+	})
+}
+
+// Stop stops displaying progress and removes the status line.
+func (p *progress) Stop() {
+	if p == nil {
+		return
+	}
+	close(p.stop)
+	p.wg.Wait()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+}
+
+// terminalWidth returns the width of the terminal from $COLUMNS, or 80.
+func terminalWidth() int {
+	if width, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && width > 1 {
+		return width
+	}
+	return 80
+}
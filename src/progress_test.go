@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/nodirt/ggt/history"
+	"github.com/nodirt/ggt/repo"
+)
+
+// newTestProgress returns a progress of commits with the given estimates
+// that is not displayed periodically.
+func newTestProgress(w *bytes.Buffer, tty bool, estimates ...commitEstimate) *progress {
+	p := &progress{
+		w:       w,
+		tty:     tty,
+		start:   time.Now(),
+		done:    map[string]bool{},
+		current: -1,
+	}
+	for i, e := range estimates {
+		id := fmt.Sprintf("%040d", i)
+		p.commits = append(p.commits, &commitPlan{commit: &history.Commit{Id: id}})
+		p.estimates = append(p.estimates, e)
+	}
+	return p
+}
+
+func TestProgressETA(t *testing.T) {
+	p := newTestProgress(&bytes.Buffer{}, false,
+		commitEstimate{d: time.Minute, known: true, runs: true},
+		commitEstimate{runs: false},
+		commitEstimate{d: time.Second, known: false, runs: true},
+	)
+	if _, ok := p.eta(); ok {
+		t.Errorf("ETA is known before any commit was evaluated")
+	}
+
+	// The unknown commit is assumed to take as long as evaluated ones.
+	p.done[p.commits[0].commit.Id] = true
+	p.actual = append(p.actual, 2*time.Minute)
+	if eta, ok := p.eta(); !ok || eta != 2*time.Minute {
+		t.Errorf("got ETA %s, %v, want 2m", eta, ok)
+	}
+}
+
+func TestProgressStatus(t *testing.T) {
+	p := newTestProgress(&bytes.Buffer{}, false,
+		commitEstimate{d: time.Minute, known: true, runs: true},
+		commitEstimate{d: time.Minute, known: true, runs: true},
+	)
+	p.startCommit(p.commits[0].commit.Id)
+	p.packageProgress(&repo.PackageSnapshot{RelPackagePath: "."}, nil)
+	want := regexp.MustCompile(`^\[1/2\] 0000000, elapsed \S+, ETA \S+$`)
+	if got := p.status(); !want.MatchString(got) {
+		t.Errorf("got status %q, want %s", got, want)
+	}
+}
+
+func TestProgressWriter(t *testing.T) {
+	var buf bytes.Buffer
+	p := newTestProgress(&buf, true, commitEstimate{runs: true})
+	p.startCommit(p.commits[0].commit.Id)
+	buf.Reset()
+
+	// Output clears the status line and redraws it after the output.
+	fmt.Fprintln(p.Writer(&buf), "hello")
+	want := regexp.MustCompile("^\r\033\\[Khello\n\r\\[1/1\\] 0000000, elapsed \\S+\033\\[K$")
+	if got := buf.String(); !want.MatchString(got) {
+		t.Errorf("got %q", got)
+	}
+
+	buf.Reset()
+	p.finishCommit(p.commits[0].commit.Id)
+	p.mu.Lock()
+	p.clear()
+	p.mu.Unlock()
+	if got := buf.String(); !regexp.MustCompile("^\r\\[1/1\\], elapsed \\S+, ETA 0s\033\\[K\r\033\\[K$").MatchString(got) {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/nodirt/ggt/bench"
+	"github.com/nodirt/ggt/repo"
+)
+
+// failureExcerptLines is the max number of lines of test output to print on failure.
+const failureExcerptLines = 10
+
+// colorChange colors a change text red if it is a change for the worse
+// and green otherwise, unless -colored=false.
+func colorChange(text string, worse bool) string {
+	if !colored {
+		return text
+	}
+	if worse {
+		return red(text)
+	}
+	return green(text)
+}
+
+// resultsPrinter prints benchmark results of a revision,
+// possibly annotated with changes relative to a base revision.
+type resultsPrinter struct {
+	w      io.Writer
+	set    *repo.PackageSet
+	series []bench.Series
+	// show returns true if b, annotated relative to prev, should be printed.
+	// prev is nil if b has no baseline. If nil, all benchmarks are printed.
+	show func(b, prev *bench.Run) bool
+	// significant returns true if the change of b relative to prev
+	// is counted as a regression or improvement in the summary.
+	// If nil, any change is significant.
+	significant func(b, prev *bench.Run) bool
+}
+
+// printDeltaLegend prints the meaning of the delta column to w.
+func printDeltaLegend(w io.Writer) {
+	fmt.Fprintf(w, "delta: change of time/op relative to the baseline, %s, old → new\n\n",
+		colorChange("+ is slower", true)+", "+colorChange("- is faster", false))
+}
+
+// annotatedRun is a benchmark run annotated relative to a baseline run.
+type annotatedRun struct {
+	pkg   string
+	run   bench.Run
+	prev  *bench.Run // nil if there is no baseline
+	label string     // describes where prev comes from
+}
+
+// Print prints failures and benchmarks of r, annotated relative to baseline,
+// followed by a summary of changes. baseline may be nil.
+// Returns the number of printed failures and benchmarks, and the summary
+// of changes of all packages.
+func (p *resultsPrinter) Print(r *bench.Results, baseline bench.BaselineFunc) (int, *changeSummary) {
+	printed := 0
+	total := &changeSummary{}
+	byPackage := map[string]*changeSummary{}
+	for i, ser := range p.series {
+		if ser.Name != "" {
+			fmt.Fprintf(p.w, "series %s:\n", ser.Name)
+		}
+		var runs []annotatedRun
+		for _, pkg := range p.set.RelPackagePaths {
+			if failure := r.Failures[i][pkg]; failure != nil {
+				p.printFailure(pkg, failure)
+				printed++
+				continue
+			}
+			if byPackage[pkg] == nil {
+				byPackage[pkg] = &changeSummary{}
+			}
+			for _, b := range r.Benchmarks[i][pkg] {
+				a := annotatedRun{pkg: pkg, run: b}
+				if baseline != nil {
+					a.prev, a.label = baseline(i, pkg, b.Name)
+					if a.prev != nil {
+						a.run.Annotate(a.prev)
+						byPackage[pkg].Add(&a.run, a.prev, p.significant == nil || p.significant(&a.run, a.prev))
+					}
+				}
+				if p.show != nil && !p.show(&a.run, a.prev) {
+					continue
+				}
+				runs = append(runs, a)
+			}
+		}
+		p.printRuns(runs)
+		printed += len(runs)
+	}
+	if len(p.series) > 1 {
+		p.printScaling(r, baseline)
+	}
+
+	for _, pkg := range p.set.RelPackagePaths {
+		if s := byPackage[pkg]; s != nil {
+			total.Merge(s)
+		}
+	}
+	if total.count > 0 {
+		fmt.Fprintf(p.w, "summary: %s\n", total)
+		if len(p.set.RelPackagePaths) > 1 {
+			for _, pkg := range p.set.RelPackagePaths {
+				if s := byPackage[pkg]; s != nil && s.count > 0 {
+					fmt.Fprintf(p.w, "    %s: %s\n", pkg, s)
+				}
+			}
+		}
+	}
+	return printed, total
+}
+
+// printRuns prints annotated runs as a table with columns
+// [package] name iterations time/op [MB/s] [B/op allocs/op] delta old→new [label].
+func (p *resultsPrinter) printRuns(runs []annotatedRun) {
+	withMem := false
+	withThroughput := false
+	for _, a := range runs {
+		if a.run.MemReported {
+			withMem = true
+		}
+		if a.run.MBPerS != 0 {
+			withThroughput = true
+		}
+	}
+
+	var t table
+	for _, a := range runs {
+		b := &a.run
+		var row *tableRow
+		if len(p.set.RelPackagePaths) > 1 {
+			row = t.Add(a.pkg, b.Name)
+		} else {
+			row = t.Add(b.Name)
+		}
+		row.cells = append(row.cells, fmt.Sprint(b.N), formatNs(float64(b.NsPerOp))+"/op")
+		if withThroughput {
+			throughput := ""
+			if b.MBPerS != 0 {
+				throughput = fmt.Sprintf("%.2f MB/s", b.MBPerS)
+			}
+			row.cells = append(row.cells, throughput)
+		}
+		if withMem {
+			row.cells = append(row.cells, formatBytes(b.BytesPerOp)+"/op", fmt.Sprintf("%d allocs/op", b.AllocsPerOp))
+		}
+		if a.prev != nil {
+			// more time is worse
+			row.AddChange(formatChange(float64(b.NsPerOpChange)), b.NsPerOpChange > 0)
+			row.cells = append(row.cells, formatNs(float64(a.prev.NsPerOp))+" → "+formatNs(float64(b.NsPerOp)))
+			if a.label != "" {
+				row.cells = append(row.cells, "("+a.label+")")
+			}
+		}
+	}
+	t.WriteTo(p.w)
+}
+
+// PrintFailures prints only failures of r.
+// Returns the number of printed failures.
+func (p *resultsPrinter) PrintFailures(r *bench.Results) int {
+	printed := 0
+	for i, ser := range p.series {
+		for _, pkg := range p.set.RelPackagePaths {
+			if failure := r.Failures[i][pkg]; failure != nil {
+				if ser.Name != "" {
+					fmt.Fprintf(p.w, "series %s: ", ser.Name)
+				}
+				p.printFailure(pkg, failure)
+				printed++
+			}
+		}
+	}
+	return printed
+}
+
+// printFailure prints a failure of a package, prefixed with the package path
+// if there are several packages.
+func (p *resultsPrinter) printFailure(pkg string, failure *bench.TestFailedError) {
+	if len(p.set.RelPackagePaths) > 1 {
+		fmt.Fprintf(p.w, "%s: ", pkg)
+	}
+	printFailure(p.w, failure)
+}
+
+// printScaling prints how many times each series is faster than the first one.
+// If baseline is not nil, also prints change of the ratio relative to baseline.
+func (p *resultsPrinter) printScaling(r *bench.Results, baseline bench.BaselineFunc) {
+	fmt.Fprintf(p.w, "scaling relative to %s:\n", p.series[0].Name)
+	var t table
+	for _, pkg := range p.set.RelPackagePaths {
+		for _, b0 := range r.Benchmarks[0][pkg] {
+			row := t.Add(b0.Name)
+			for i := 1; i < len(p.series); i++ {
+				b := r.Benchmarks[i][pkg].Find(b0.Name)
+				if b == nil {
+					row.cells = append(row.cells, "", "")
+					continue
+				}
+				ratio := bench.ScalingRatio(&b0, b)
+				row.cells = append(row.cells, fmt.Sprintf("%s x%.2f", p.series[i].Name, ratio))
+				change := ""
+				if baseline != nil {
+					prev0, label0 := baseline(0, pkg, b0.Name)
+					prev, label := baseline(i, pkg, b0.Name)
+					if prev0 != nil && prev != nil && label0 == label {
+						if prevRatio := bench.ScalingRatio(prev0, prev); prevRatio != 0 {
+							change = formatChange(100 * (ratio - prevRatio) / prevRatio)
+						}
+					}
+				}
+				// lower ratio is worse scaling
+				row.AddChange(change, strings.HasPrefix(change, "-"))
+			}
+		}
+	}
+	t.WriteTo(p.w)
+}
+
+// printFailure prints a failure marker and an excerpt of the test output to w.
+func printFailure(w io.Writer, err *bench.TestFailedError) {
+	msg := err.Error()
+	if colored {
+		msg = red(msg)
+	}
+	fmt.Fprintln(w, msg)
+	for _, line := range err.Excerpt(failureExcerptLines) {
+		fmt.Fprintln(w, "    "+line)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/nodirt/ggt/bench"
+)
+
+// changeSummary summarizes changes of benchmarks relative to a baseline.
+type changeSummary struct {
+	logRatioSum  float64 // sum of log(new/old) of time/op
+	count        int     // number of compared benchmarks
+	regressions  int     // number of significant regressions
+	improvements int     // number of significant improvements
+}
+
+// Add adds the change of b relative to prev to s.
+// b must be annotated relative to prev.
+func (s *changeSummary) Add(b, prev *bench.Run, significant bool) {
+	if b.NsPerOp <= 0 || prev.NsPerOp <= 0 {
+		return
+	}
+	s.logRatioSum += math.Log(float64(b.NsPerOp) / float64(prev.NsPerOp))
+	s.count++
+	if significant {
+		if b.NsPerOpChange > 0 {
+			s.regressions++
+		} else if b.NsPerOpChange < 0 {
+			s.improvements++
+		}
+	}
+}
+
+// Merge adds changes summarized in other to s.
+func (s *changeSummary) Merge(other *changeSummary) {
+	s.logRatioSum += other.logRatioSum
+	s.count += other.count
+	s.regressions += other.regressions
+	s.improvements += other.improvements
+}
+
+// Geomean returns the geometric mean of time/op changes, in percents.
+func (s *changeSummary) Geomean() float64 {
+	if s.count == 0 {
+		return 0
+	}
+	return 100 * (math.Exp(s.logRatioSum/float64(s.count)) - 1)
+}
+
+// String returns a one-line summary with colored geomean.
+func (s *changeSummary) String() string {
+	geomean := s.Geomean()
+	parts := []string{
+		"geomean " + colorChange(formatChange(geomean), geomean > 0),
+		pluralize(s.regressions, "regression"),
+		pluralize(s.improvements, "improvement"),
+		pluralize(s.count, "benchmark"),
+	}
+	return strings.Join(parts, ", ")
+}
+
+// pluralize returns "<n> <noun>" with noun in plural form if n != 1.
+func pluralize(n int, noun string) string {
+	if n != 1 {
+		noun += "s"
+	}
+	return fmt.Sprintf("%d %s", n, noun)
+}
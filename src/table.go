@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// table renders rows of cells aligned in columns.
+type table struct {
+	rows []*tableRow
+}
+
+// tableRow is a row of a table.
+type tableRow struct {
+	cells []string
+	// changes maps indexes of cells to color with colorChange to
+	// true if the change is for the worse.
+	changes map[int]bool
+}
+
+// Add appends a row of cells to t.
+func (t *table) Add(cells ...string) *tableRow {
+	r := &tableRow{cells: cells, changes: map[int]bool{}}
+	t.rows = append(t.rows, r)
+	return r
+}
+
+// AddChange appends a cell that is colored as a change.
+func (r *tableRow) AddChange(cell string, worse bool) {
+	r.changes[len(r.cells)] = worse
+	r.cells = append(r.cells, cell)
+}
+
+// WriteTo writes the aligned rows to w.
+func (t *table) WriteTo(w io.Writer) (int64, error) {
+	// Alignment is computed on uncolored text, because tabwriter
+	// counts color escape codes as visible characters.
+	var buf bytes.Buffer
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	for _, r := range t.rows {
+		fmt.Fprintln(tw, strings.Join(r.cells, "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return 0, err
+	}
+
+	var written int64
+	lines := strings.SplitAfter(buf.String(), "\n")
+	for i, r := range t.rows {
+		line := strings.TrimRight(lines[i], " \n")
+		if colored {
+			// Replace cells from the end, so that earlier cells are not matched.
+			offset := len(line)
+			for j := len(r.cells) - 1; j >= 0; j-- {
+				cell := r.cells[j]
+				k := strings.LastIndex(line[:offset], cell)
+				if k < 0 {
+					continue
+				}
+				offset = k
+				if worse, ok := r.changes[j]; ok && cell != "" {
+					line = line[:k] + colorChange(cell, worse) + line[k+len(cell):]
+				}
+			}
+		}
+		n, err := fmt.Fprintln(w, line)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/nodirt/ggt/bench"
+	"github.com/nodirt/ggt/repo"
+)
+
+// cmdToolchains is `ggt toolchains` command.
+// It runs benchmarks of one revision under several Go toolchains
+// and reports changes relative to the first toolchain.
+type cmdToolchains struct {
+	packages   []string
+	benchRegex string         // will be passed to `go test`
+	revision   string         // revision to benchmark
+	toolchains stringList     // GOROOT dirs or go binaries
+	settings   bench.Settings // passed to every `go test` run
+}
+
+func (*cmdToolchains) name() string {
+	return "toolchains"
+}
+
+func (*cmdToolchains) shortDescription() string {
+	return "compare benchmark results of a revision under several Go toolchains"
+}
+
+func (*cmdToolchains) usage() {
+	fmt.Println("usage: ggt toolchains [options] -toolchain=<go1> -toolchain=<go2> [revision] [--] [packages]")
+	fmt.Println()
+	fmt.Println("Options:")
+	flag.PrintDefaults()
+}
+
+func (c *cmdToolchains) parseFlags(args []string) error {
+	flag.StringVar(&c.benchRegex, "bench", ".", "test name regex")
+	flag.Var(&c.toolchains, "toolchain", "GOROOT directory or go binary, e.g. go1.21.0. The first one is the baseline. Must be repeated.")
+	addBuildSettingsFlags(&c.settings)
+	args = parseFlags(args)
+
+	if len(c.toolchains) < 2 {
+		return fmt.Errorf("at least two toolchains must be specified")
+	}
+	if err := c.settings.Validate(); err != nil {
+		return err
+	}
+
+	c.revision = "HEAD"
+	if len(args) > 0 && args[0] != "--" {
+		c.revision = args[0]
+		args = args[1:]
+	}
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	c.packages = args
+	if len(c.packages) == 0 {
+		return fmt.Errorf("packages are not specified")
+	}
+	return nil
+}
+
+func (c *cmdToolchains) run() error {
+	set, err := openPackageSet(c.packages)
+	if err != nil {
+		return err
+	}
+
+	sandbox, err := repo.NewSandbox(set, c.revision)
+	if err != nil {
+		return err
+	}
+	defer sandbox.Close()
+
+	printer := &resultsPrinter{w: os.Stdout, set: set, series: []bench.Series{{}}}
+	printDeltaLegend(os.Stdout)
+	var baseline *bench.Results
+	for i, spec := range c.toolchains {
+		settings := c.settings
+		settings.SetToolchain(spec)
+		if err := settings.Validate(); err != nil {
+			return err
+		}
+		if err := settings.ResolveToolchain(); err != nil {
+			return err
+		}
+
+		if i > 0 {
+			fmt.Println()
+		}
+		header := fmt.Sprintf("toolchain %s (%s)", spec, settings.GoVersion)
+		if i == 0 {
+			header += ", baseline"
+		}
+		fmt.Println(header)
+		fmt.Println()
+
+		results := bench.NewResults(1)
+		if err := sandbox.WithSettings(settings).CollectBenchmarks(c.benchRegex, results, 0); err != nil {
+			return err
+		}
+
+		if baseline == nil {
+			printer.Print(results, nil)
+			baseline = results
+		} else {
+			printer.Print(results, baseline.Baseline())
+		}
+	}
+	return nil
+}
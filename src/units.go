@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// formatSignificant formats v, 1 <= v < 1000, with 3 significant digits.
+func formatSignificant(v float64) string {
+	switch {
+	case v >= 100:
+		return fmt.Sprintf("%.0f", v)
+	case v >= 10:
+		return fmt.Sprintf("%.1f", v)
+	default:
+		return fmt.Sprintf("%.2f", v)
+	}
+}
+
+// formatNs formats a duration in nanoseconds with a unit from ns to s.
+func formatNs(ns float64) string {
+	units := []string{"ns", "µs", "ms", "s"}
+	i := 0
+	for ; i < len(units)-1 && math.Abs(ns) >= 999.5; i++ {
+		ns /= 1000
+	}
+	return formatSignificant(ns) + units[i]
+}
+
+// formatDuration formats d rounded to seconds, or to milliseconds if it is shorter.
+func formatDuration(d time.Duration) string {
+	if d >= time.Second {
+		return d.Round(time.Second).String()
+	}
+	return d.Round(time.Millisecond).String()
+}
+
+// formatBytes formats a number of bytes with a unit from B to GiB.
+func formatBytes(b int64) string {
+	if b < 1024 {
+		return fmt.Sprintf("%dB", b)
+	}
+	units := []string{"KiB", "MiB", "GiB"}
+	v := float64(b) / 1024
+	i := 0
+	for ; i < len(units)-1 && v >= 1023.5; i++ {
+		v /= 1024
+	}
+	return formatSignificant(v) + units[i]
+}
+
+// formatChange formats a percentage change with a precision
+// that depends on its magnitude.
+func formatChange(percent float64) string {
+	switch abs := math.Abs(percent); {
+	case percent == 0:
+		return "~"
+	case abs >= 100:
+		return fmt.Sprintf("%+.0f%%", percent)
+	case abs >= 0.1:
+		return fmt.Sprintf("%+.1f%%", percent)
+	default:
+		return fmt.Sprintf("%+.2f%%", percent)
+	}
+}
+
+// formatNsChange formats a change of a duration in nanoseconds with a sign.
+func formatNsChange(ns float64) string {
+	switch {
+	case ns == 0:
+		return "~"
+	case ns < 0:
+		return "-" + formatNs(-ns)
+	default:
+		return "+" + formatNs(ns)
+	}
+}
@@ -0,0 +1,88 @@
+// Package store persists benchmark results of package snapshots
+// in the git dir of the repository.
+package store
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nodirt/ggt/bench"
+)
+
+// Filename returns path to the cache file of a package at a git tree
+// in the repository with gitDir.
+// Results of runs with non-default build settings, identified by
+// bench.Settings.CacheKey, are stored in separate files.
+func Filename(gitDir, treeId, relPackagePath, settingsKey string) string {
+	name := "dir-cache.json"
+	if settingsKey != "" {
+		name = "dir-cache-" + settingsKey + ".json"
+	}
+	return filepath.Join(gitDir, "ggt", "tree-cache", treeId, relPackagePath, name)
+}
+
+// ProfileFilename returns path to a profile of a benchmark of a package
+// at a git tree, next to the cache file, see Filename.
+// ext identifies the kind of the profile, e.g. "cpu.pprof".
+func ProfileFilename(gitDir, treeId, relPackagePath, settingsKey, benchmark, ext string) string {
+	dir := "profiles"
+	if settingsKey != "" {
+		dir = "profiles-" + settingsKey
+	}
+	// Names of sub-benchmarks contain slashes. Escaping is reversible,
+	// so different names map to different files.
+	name := url.PathEscape(benchmark) + "." + ext
+	return filepath.Join(gitDir, "ggt", "tree-cache", treeId, relPackagePath, dir, name)
+}
+
+// Cache stores previously ran benchmarks and known test names
+// of a package snapshot.
+type Cache struct {
+	Benchmarks bench.RunSlice
+	// BenchmarksIsComplete is true if Benchmarks is a full list of benchmarks
+	// in the package snapshot
+	BenchmarksIsComplete bool
+
+	AllBenchmarkNames []string // all test names. Nil if unknown.
+
+	// Failure is set if go test failed in the package snapshot.
+	Failure *bench.TestFailedError
+	// FailureBenchRegex is the -bench value of the failed run.
+	// Ignored if Failure.BuildFailed is true.
+	FailureBenchRegex string
+
+	// BuildDuration is wall time of the last build of the package tests.
+	// 0 if unknown.
+	BuildDuration time.Duration `json:",omitempty"`
+}
+
+// Load initializes c state from a file.
+func (c *Cache) Load(filename string) error {
+	*c = Cache{}
+	f, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	return json.NewDecoder(f).Decode(c)
+}
+
+// Save persists c state to a file.
+func (c *Cache) Save(filename string) error {
+	dir := filepath.Dir(filename)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(c)
+}